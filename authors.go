@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"bitbucket.org/iharsuvorau/ims-publications/orcid"
+)
+
+// citeAuthors formats the list of authors in a citation style, authors
+// with an ORCID iD are linked to their ORCID records. Supported styles:
+//
+//	apa:       Doe, J., Smith, A. B., & Roe, R.
+//	ieee:      J. Doe, A. B. Smith, and R. Roe
+//	vancouver: Doe J, Smith AB, Roe R
+//
+// It's used in templates as {{citeAuthors "apa" .Contributors}}.
+func citeAuthors(style string, contribs []*orcid.Contributor) (string, error) {
+	var format func(given, family string) string
+	var join func(names []string) string
+
+	switch style {
+	case "apa":
+		format = func(given, family string) string {
+			if in := initials(given, ". ", "."); len(in) > 0 {
+				return family + ", " + in
+			}
+			return family
+		}
+		join = func(names []string) string {
+			return joinNames(names, ", ", ", & ", ", & ")
+		}
+	case "ieee":
+		format = func(given, family string) string {
+			return strings.TrimSpace(initials(given, ". ", ".") + " " + family)
+		}
+		join = func(names []string) string {
+			return joinNames(names, ", ", " and ", ", and ")
+		}
+	case "vancouver":
+		format = func(given, family string) string {
+			return strings.TrimSpace(family + " " + initials(given, "", ""))
+		}
+		join = func(names []string) string {
+			return strings.Join(names, ", ")
+		}
+	default:
+		return "", fmt.Errorf("unsupported citation style: %s", style)
+	}
+
+	names := make([]string, 0, len(contribs))
+	for _, c := range contribs {
+		name := format(c.Names())
+		if len(name) == 0 {
+			continue
+		}
+		if !c.ORCID.IsEmpty() {
+			name = fmt.Sprintf("[https://orcid.org/%s %s]", c.ORCID, name)
+		}
+		names = append(names, name)
+	}
+
+	return join(names), nil
+}
+
+// initials turns given names into initials, e.g. "Jane Mary" becomes
+// "J. M." with the ". " separator and the "." suffix.
+func initials(given, sep, suffix string) string {
+	parts := strings.Fields(given)
+	if len(parts) == 0 {
+		return ""
+	}
+
+	letters := make([]string, len(parts))
+	for i, p := range parts {
+		letters[i] = string([]rune(p)[:1])
+	}
+
+	return strings.Join(letters, sep) + suffix
+}
+
+// joinNames joins names with sep, the last name is joined with pair if
+// there are two names only or with last otherwise.
+func joinNames(names []string, sep, pair, last string) string {
+	switch len(names) {
+	case 0:
+		return ""
+	case 1:
+		return names[0]
+	case 2:
+		return names[0] + pair + names[1]
+	default:
+		return strings.Join(names[:len(names)-1], sep) + last + names[len(names)-1]
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"bitbucket.org/iharsuvorau/ims-publications/cache"
+	"bitbucket.org/iharsuvorau/ims-publications/crossref"
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
+	"bitbucket.org/iharsuvorau/ims-publications/orcid"
+)
+
+// defaultCacheDir returns the user's cache directory for the program
+// or a directory relative to the current one if the user's one is
+// unknown.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "publications-cache"
+	}
+	return filepath.Join(dir, "publications-update")
+}
+
+// worksCacheKey is a cache key for ORCID works of a user.
+func worksCacheKey(id orcid.ID) string {
+	return fmt.Sprintf("orcid/%s.xml", id)
+}
+
+// crossrefCacheKey is a cache key for a CrossRef work.
+func crossrefCacheKey(id doi.DOI) string {
+	return fmt.Sprintf("crossref/%s.json", url.PathEscape(string(id)))
+}
+
+// doiCacheKey is a cache key for DOI metadata resolved by content
+// negotiation.
+func doiCacheKey(id doi.DOI) string {
+	return fmt.Sprintf("doi/%s.json", url.PathEscape(string(id)))
+}
+
+// dataciteCacheKey is a cache key for a DataCite record.
+func dataciteCacheKey(id doi.DOI) string {
+	return fmt.Sprintf("datacite/%s.json", url.PathEscape(string(id)))
+}
+
+// crossrefSearchCacheKey is a cache key for results of a CrossRef
+// search, the query is hashed to make a file name.
+func crossrefSearchCacheKey(q crossref.Query) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s\x00%s\x00%d", q.Bibliographic, q.Author, q.Rows)))
+	return fmt.Sprintf("crossref/search/%x.json", sum)
+}
+
+// readCachedJSON decodes the entry into v if it's fresh. The cache is
+// optional, false is returned for a nil cache.
+func readCachedJSON(c *cache.Cache, key string, v interface{}) (bool, error) {
+	if c == nil || !c.IsFresh(key) {
+		return false, nil
+	}
+	f, err := c.Open(key)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	if err = json.NewDecoder(f).Decode(v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeCachedJSON encodes v into the entry. The cache is optional,
+// nothing is written to a nil cache.
+func writeCachedJSON(c *cache.Cache, key string, v interface{}) error {
+	if c == nil {
+		return nil
+	}
+	f, err := c.Create(key)
+	if err != nil {
+		return err
+	}
+	if err = json.NewEncoder(f).Encode(v); err != nil {
+		f.Discard()
+		return err
+	}
+	return f.Close()
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [cache list|prune]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Without a command, works are fetched and MediaWiki pages are updated.")
+	fmt.Fprintln(out, "The cache command lists or removes obsolete entries of the -cache-dir directory.")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// runCommand executes a command given in arguments instead of the
+// default pages update.
+func runCommand(c *cache.Cache, args []string, out io.Writer) error {
+	if len(args) != 2 || args[0] != "cache" {
+		return fmt.Errorf("unknown command: %v", args)
+	}
+
+	var entries []cache.Entry
+	var err error
+
+	switch args[1] {
+	case "list":
+		entries, err = c.Entries()
+	case "prune":
+		entries, err = c.Prune()
+	default:
+		return fmt.Errorf("unknown cache command: %s", args[1])
+	}
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, e := range entries {
+		state := "fresh"
+		if !e.Fresh {
+			state = "obsolete"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", e.Key, e.Size, e.Modified.Format(time.RFC3339), state)
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	if args[1] == "prune" {
+		fmt.Fprintf(out, "%d entries removed from %s\n", len(entries), c.Dir())
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+// Package cache keeps downloaded records as files on disk and decides
+// when they become obsolete.
+//
+// Entries are addressed by keys which are relative slash-separated
+// paths, e.g. "orcid/0000-0002-0183-1282.xml", so different sources
+// can share one cache directory without clashes.
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Cache is a directory with entries which stay fresh during the TTL
+// after their last modification.
+type Cache struct {
+	dir       string
+	ttl       time.Duration
+	notBefore time.Time
+}
+
+// New returns a cache located in dir, the directory is created if
+// needed. Entries older than ttl are considered obsolete.
+func New(dir string, ttl time.Duration) (*Cache, error) {
+	if len(dir) == 0 {
+		return nil, fmt.Errorf("cache directory must be specified")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory %s: %v", dir, err)
+	}
+	return &Cache{dir: dir, ttl: ttl}, nil
+}
+
+// Dir returns the cache directory.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// TTL returns the duration during which entries are fresh.
+func (c *Cache) TTL() time.Duration {
+	return c.ttl
+}
+
+// Refresh makes all entries written before the call obsolete, while
+// entries written afterwards stay fresh during the TTL as usual.
+func (c *Cache) Refresh() {
+	// file systems might have a coarse modification time, so the
+	// start of the current second is used
+	c.notBefore = time.Now().Truncate(time.Second)
+}
+
+// Path returns the file path of the entry.
+func (c *Cache) Path(key string) string {
+	return filepath.Join(c.dir, filepath.FromSlash(key))
+}
+
+// Exists checks if the entry exists regardless of its age.
+func (c *Cache) Exists(key string) bool {
+	_, err := os.Stat(c.Path(key))
+	return err == nil
+}
+
+// IsFresh checks if the entry exists and was modified during the TTL.
+func (c *Cache) IsFresh(key string) bool {
+	stat, err := os.Stat(c.Path(key))
+	if err != nil {
+		return false
+	}
+	return c.isFresh(stat.ModTime())
+}
+
+func (c *Cache) isFresh(modified time.Time) bool {
+	return !modified.Before(c.notBefore) && time.Since(modified) < c.ttl
+}
+
+// Open opens the entry for reading.
+func (c *Cache) Open(key string) (*os.File, error) {
+	return os.Open(c.Path(key))
+}
+
+// Create returns a writer of the entry, the caller must close it. The
+// data is written into a temporary file which replaces the entry on
+// Close, so a failed or interrupted write never leaves a partial entry.
+func (c *Cache) Create(key string) (*Writer, error) {
+	fpath := c.Path(key)
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(fpath), "."+filepath.Base(fpath)+".*")
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &Writer{File: f, path: fpath}, nil
+}
+
+// Writer writes an entry into a temporary file.
+type Writer struct {
+	*os.File
+	path string
+	done bool
+}
+
+// Close closes the temporary file and replaces the entry with it.
+func (w *Writer) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	err := w.File.Close()
+	if err == nil {
+		err = os.Rename(w.File.Name(), w.path)
+	}
+	if err != nil {
+		os.Remove(w.File.Name())
+	}
+	return err
+}
+
+// Discard removes the temporary file and leaves the entry as it is, a
+// following Close does nothing.
+func (w *Writer) Discard() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	w.File.Close()
+	return os.Remove(w.File.Name())
+}
+
+// Invalidate removes the entry. Removing of a missing entry is not an
+// error.
+func (c *Cache) Invalidate(key string) error {
+	err := os.Remove(c.Path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Entry describes a cached file.
+type Entry struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+	Fresh    bool
+}
+
+// Entries lists all entries sorted by key.
+func (c *Cache) Entries() ([]Entry, error) {
+	entries := []Entry{}
+	err := filepath.Walk(c.dir, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(c.dir, fpath)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, Entry{
+			Key:      filepath.ToSlash(rel),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+			Fresh:    c.isFresh(info.ModTime()),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+
+	return entries, nil
+}
+
+// Prune removes obsolete entries and returns them.
+func (c *Cache) Prune() ([]Entry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := []Entry{}
+	for _, e := range entries {
+		if e.Fresh {
+			continue
+		}
+		if err = c.Invalidate(e.Key); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, e)
+	}
+
+	return pruned, nil
+}
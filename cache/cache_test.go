@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := New(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const key = "orcid/0000-0002-0183-1282.xml"
+
+	if c.IsFresh(key) || c.Exists(key) {
+		t.Fatal("missing entry can't be fresh")
+	}
+
+	f, err := c.Create(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if !c.IsFresh(key) {
+		t.Error("new entry must be fresh")
+	}
+
+	old := time.Now().Add(-time.Hour * 2)
+	if err = os.Chtimes(c.Path(key), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if c.IsFresh(key) || !c.Exists(key) {
+		t.Error("old entry must exist and be obsolete")
+	}
+
+	entries, err := c.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Key != key || entries[0].Fresh {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+
+	pruned, err := c.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || c.Exists(key) {
+		t.Errorf("obsolete entry must be pruned, got %+v", pruned)
+	}
+
+	if err = c.Invalidate(key); err != nil {
+		t.Errorf("invalidation of a missing entry must not fail: %v", err)
+	}
+}
+
+func TestCache_Refresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := New(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const key = "crossref/10.1000%2F1.json"
+
+	f, err := c.Create(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	old := time.Now().Add(-time.Minute)
+	if err = os.Chtimes(c.Path(key), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Refresh()
+	if c.IsFresh(key) {
+		t.Error("entry written before the refresh must be obsolete")
+	}
+
+	f, err = c.Create(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if !c.IsFresh(key) {
+		t.Error("entry written after the refresh must be fresh")
+	}
+}
+
+func TestCache_Create(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := New(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const key = "crossref/10.1000%2F1.json"
+
+	write := func(data string, discard bool) {
+		f, err := c.Create(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+		if c.Exists(key) {
+			if b, err := ioutil.ReadFile(c.Path(key)); err != nil || string(b) == data {
+				t.Errorf("entry must not be changed before Close, got %q", b)
+			}
+		}
+		if discard {
+			if err = f.Discard(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("first", false)
+	write("second", true)
+
+	b, err := ioutil.ReadFile(c.Path(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "first" {
+		t.Errorf("want the discarded write ignored, got %q", b)
+	}
+
+	entries, err := c.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Key != key {
+		t.Errorf("want no temporary files left, got %+v", entries)
+	}
+}
@@ -1,45 +1,202 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
-	"time"
 
+	"bitbucket.org/iharsuvorau/ims-publications/cache"
 	"bitbucket.org/iharsuvorau/ims-publications/crossref"
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
 	"bitbucket.org/iharsuvorau/ims-publications/orcid"
 )
 
-func crossRefContributors(w *orcid.Work, cref *crossref.Client, logger *log.Logger) []*orcid.Contributor {
-	if len(w.Contributors) > 0 {
-		return nil
+func contributorsFromCrossRef(work *crossref.Work) []*orcid.Contributor {
+	contribs := []*orcid.Contributor{}
+	for _, v := range work.Authors {
+		c := &orcid.Contributor{
+			Name:       v.FullName(),
+			GivenName:  v.Given,
+			FamilyName: v.Family,
+			Sequence:   v.Sequence,
+			Role:       "author",
+		}
+		if len(v.ORCID) > 0 {
+			if id, err := orcid.IDFromURL(v.ORCID); err == nil {
+				c.ORCID = id
+			}
+		}
+		contribs = append(contribs, c)
 	}
+	return contribs
+}
 
-	// TODO: another DOI check was introduced through the .HasDOI() and .GetDOI() methods on orcid.Work. Have to unify the procedure.
+// missingMetadata checks if the work lacks fields which can be filled
+// from CrossRef or other registries by completeWork.
+func missingMetadata(w *orcid.Work) bool {
+	return len(w.JournalTitle) == 0 || w.Year == 0 || len(w.Type) == 0 || w.Type == "other"
+}
 
-	// DOI check
-	if len(string(w.DoiURI)) == 0 {
-		logger.Printf("publication doesn't have DOI: %v", w.Title)
-		return nil
+// completeWork fills the journal title, publication date and type of
+// the ORCID work if they are missing. Fields set in ORCID are never
+// overwritten, empty values are ignored.
+func completeWork(w *orcid.Work, journalTitle string, year, month, day int, workType string) {
+	if len(w.JournalTitle) == 0 {
+		w.JournalTitle = journalTitle
+	}
+
+	if w.Year == 0 {
+		w.Year, w.Month, w.Day = year, month, day
 	}
 
-	// crossref download
-	id, err := crossref.DOIFromURL(string(w.DoiURI))
+	if (len(w.Type) == 0 || w.Type == "other") && len(workType) > 0 {
+		w.Type = workType
+	}
+}
+
+// completeWithCrossRef fills the journal title, publication date and type
+// of the ORCID work from the CrossRef work if they are missing.
+func completeWithCrossRef(w *orcid.Work, work *crossref.Work) {
+	date := work.Issued
+	if date.IsZero() {
+		date = work.Published
+	}
+	completeWork(w, work.ContainerTitle, date.Year, date.Month, date.Day, crossRefTypes[work.Type])
+}
+
+// crossRefTypes maps CrossRef work types to ORCID ones, types without
+// a counterpart are left as they are in ORCID.
+var crossRefTypes = map[string]string{
+	"journal-article":     "journal-article",
+	"proceedings-article": "conference-paper",
+	"book":                "book",
+	"monograph":           "book",
+	"reference-book":      "book",
+	"edited-book":         "edited-book",
+	"book-chapter":        "book-chapter",
+	"book-section":        "book-chapter",
+	"book-part":           "book-chapter",
+	"dissertation":        "dissertation",
+	"report":              "report",
+	"dataset":             "data-set",
+	"posted-content":      "preprint",
+	"standard":            "standards-and-policy",
+	"peer-review":         "review",
+}
+
+// getCrossRefWork returns a CrossRef work from the cache if it's fresh,
+// otherwise the work is downloaded and cached. Works which CrossRef
+// doesn't know are cached as null, so they aren't requested again until
+// the entry is obsolete, and crossref.ErrNotFound is returned for them.
+// The cache is optional.
+func getCrossRefWork(ctx context.Context, cref *crossref.Client, c *cache.Cache, id doi.DOI, logger *log.Logger) (*crossref.Work, error) {
+	key := crossrefCacheKey(id)
+
+	var work *crossref.Work
+	ok, err := readCachedJSON(c, key, &work)
 	if err != nil {
-		log.Println(err)
-		return nil
+		logger.Printf("failed to read the cached crossref work %s: %v", id, err)
+	}
+	if ok {
+		if work == nil {
+			return nil, fmt.Errorf("crossref work %s: %w", id, crossref.ErrNotFound)
+		}
+		return work, nil
 	}
 
-	logger.Printf("crossref fetch: %s, %s", w.Title, id)
-	work, err := crossref.GetWork(cref, id)
+	logger.Printf("crossref fetch: %s", id)
+	work, err = crossref.GetWork(ctx, cref, id)
+	if errors.Is(err, crossref.ErrNotFound) {
+		if err := writeCachedJSON(c, key, nil); err != nil {
+			logger.Printf("failed to cache the missing crossref work %s: %v", id, err)
+		}
+	}
 	if err != nil {
-		logger.Printf("crossref fetch error: %v", err)
-		time.Sleep(time.Second * 1) // give the server time to rest
+		return nil, err
+	}
+
+	if err = writeCachedJSON(c, key, work); err != nil {
+		logger.Printf("failed to cache the crossref work %s: %v", id, err)
+	}
+
+	return work, nil
+}
+
+// lookupCrossRefWork returns the prefetched CrossRef work of the DOI, a
+// nil prefetched work is not found. Works which are not prefetched are
+// read from the cache or fetched by getCrossRefWork.
+func lookupCrossRefWork(ctx context.Context, cref *crossref.Client, c *cache.Cache, prefetched map[doi.DOI]*crossref.Work, id doi.DOI, logger *log.Logger) (*crossref.Work, error) {
+	work, ok := prefetched[id]
+	if !ok {
+		return getCrossRefWork(ctx, cref, c, id, logger)
+	}
+	if work == nil {
+		return nil, fmt.Errorf("crossref work %s: %w", id, crossref.ErrNotFound)
+	}
+	return work, nil
+}
+
+// prefetchCrossRefWorks downloads CrossRef works of the users which need
+// them and are not cached yet in batches and caches them, see
+// prefetchCrossRefDOIs.
+func prefetchCrossRefWorks(ctx context.Context, cref *crossref.Client, c *cache.Cache, users []*user, logger *log.Logger) map[doi.DOI]*crossref.Work {
+	ids := []doi.DOI{}
+	for _, u := range users {
+		for _, w := range u.Works {
+			if len(w.Contributors) > 0 && !missingMetadata(w) {
+				continue
+			}
+			if id, err := w.DOI(); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return prefetchCrossRefDOIs(ctx, cref, c, ids, logger)
+}
+
+// prefetchCrossRefDOIs downloads CrossRef works of the DOIs which are
+// not cached yet in batches and caches them. The returned works are
+// keyed by DOIs, DOIs which CrossRef doesn't know have nil works and are
+// cached as null. Works which could not be fetched are missing, they are
+// fetched one by one later.
+func prefetchCrossRefDOIs(ctx context.Context, cref *crossref.Client, c *cache.Cache, dois []doi.DOI, logger *log.Logger) map[doi.DOI]*crossref.Work {
+	ids := []doi.DOI{}
+	seen := map[doi.DOI]bool{}
+	for _, id := range dois {
+		if seen[id] || c != nil && c.IsFresh(crossrefCacheKey(id)) {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
 		return nil
 	}
 
-	contribs := []*orcid.Contributor{}
-	for _, v := range work.Authors {
-		contribs = append(contribs, &orcid.Contributor{Name: v})
+	logger.Printf("crossref batch fetch: %d works", len(ids))
+	works, err := crossref.GetWorks(ctx, cref, ids)
+	if err != nil {
+		logger.Printf("crossref batch fetch error: %v", err)
+	}
+	for id, work := range works {
+		if err := writeCachedJSON(c, crossrefCacheKey(id), work); err != nil {
+			logger.Printf("failed to cache the crossref work %s: %v", id, err)
+		}
 	}
 
-	return contribs
+	// missing works are known to be unknown only if all batches are
+	// received
+	if err == nil {
+		for _, id := range ids {
+			if _, ok := works[id]; ok {
+				continue
+			}
+			works[id] = nil
+			if err := writeCachedJSON(c, crossrefCacheKey(id), nil); err != nil {
+				logger.Printf("failed to cache the missing crossref work %s: %v", id, err)
+			}
+		}
+	}
+	return works
 }
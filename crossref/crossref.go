@@ -5,25 +5,77 @@
 package crossref
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
+	"bitbucket.org/iharsuvorau/ims-publications/internal/throttle"
 )
 
 // Library specific
 
-// Client is a crossref client which handles all further requests.
+// Client is a crossref client which handles all further requests. The
+// client follows the etiquette of the API: it identifies itself by the
+// User-Agent header and throttles itself according to the rate limit
+// announced in responses.
 type Client struct {
-	apiBase   *url.URL
-	worksPath *url.URL
+	apiBase    *url.URL
+	worksPath  *url.URL
+	userAgent  string
+	limiter    *throttle.Limiter
+	backoff    throttle.Backoff
+	httpClient *http.Client
+}
+
+// Option configures a client.
+type Option func(*Client)
+
+// WithMailto adds the contact email address to the User-Agent header,
+// so the requests are served by the "polite" pool of servers and
+// CrossRef can contact you in case of problems.
+func WithMailto(email string) Option {
+	return func(c *Client) {
+		if len(email) > 0 {
+			c.userAgent = fmt.Sprintf("%s (%s; mailto:%s)", userAgentName, userAgentURL, email)
+		}
+	}
+}
+
+// WithRetries sets the amount of retries of a request failed because of
+// a network error, the 429 or 5xx status. Three retries are made by
+// default.
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		c.backoff.Retries = n
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for all requests, e.g. to
+// configure timeouts, a proxy or a transport. http.DefaultClient is used
+// by default.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		if hc != nil {
+			c.httpClient = hc
+		}
+	}
 }
 
+const (
+	userAgentName = "ims-publications"
+	userAgentURL  = "https://bitbucket.org/iharsuvorau/ims-publications"
+)
+
 // New returns a new client with generated internal API URLs.
-func New(apiBase string) (*Client, error) {
+func New(apiBase string, opts ...Option) (*Client, error) {
 	apiBase = strings.TrimRight(apiBase, "/") + "/"
 
 	u, err := url.Parse(apiBase)
@@ -37,10 +89,19 @@ func New(apiBase string) (*Client, error) {
 	}
 	worksPath := u.ResolveReference(w)
 
-	return &Client{
-		apiBase:   u,
-		worksPath: worksPath,
-	}, nil
+	c := &Client{
+		apiBase:    u,
+		worksPath:  worksPath,
+		userAgent:  fmt.Sprintf("%s (%s)", userAgentName, userAgentURL),
+		limiter:    throttle.NewLimiter(0),
+		backoff:    throttle.Backoff{Retries: 3, Min: time.Second, Max: time.Second * 30},
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
 }
 
 // APIBase returns the base URL.
@@ -53,111 +114,565 @@ func (c *Client) WorksPath() *url.URL {
 	return c.worksPath
 }
 
-// DOI is a unique identifier of a publication.
-type DOI string
-
-func (id DOI) String() string {
-	return url.PathEscape(string(id))
+// UserAgent returns the User-Agent header sent by the client.
+func (c *Client) UserAgent() string {
+	return c.userAgent
 }
 
-// DOIFromURL returns DOI from an URL string. Read
-// https://www.doi.org/doi_handbook/2_Numbering.html#2.2 for more on
-// the syntax of DOI.
-func DOIFromURL(s string) (DOI, error) {
-	// the regexp still doesn't catch unwanted chars like &<>"'
-	re := regexp.MustCompile(`\b(10[.][0-9]*(?:[.][0-9]+)*\/.*\S+)\b`)
+// get requests the URL waiting for the rate limit and retrying
+// transient failures until the context is done. The caller must close
+// the body of the response.
+func (c *Client) get(ctx context.Context, uri string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
 
-	parts := re.FindStringSubmatch(s)
-	if len(parts) > 0 {
-		return DOI(parts[0]), nil
+	var resp *http.Response
+	for retry := 0; ; retry++ {
+		if err = c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		resp, err = c.httpClient.Do(req)
+		if err == nil {
+			c.updateRateLimit(resp.Header)
+		}
+		if err == nil && !throttle.Retryable(resp.StatusCode) || retry >= c.backoff.Retries {
+			break
+		}
+
+		delay := c.backoff.Delay(retry)
+		if err == nil {
+			if d, ok := throttle.RetryAfter(resp.Header); ok {
+				delay = d
+			}
+			resp.Body.Close()
+		}
+		if err = throttle.Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %v", uri, err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to get %s: %w", uri, ErrNotFound)
 	}
-	return DOI(""), fmt.Errorf("no DOI found in %s", s)
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to get %s: %v", uri, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// updateRateLimit adjusts the limiter to the X-Rate-Limit-Limit requests
+// per X-Rate-Limit-Interval announced by the API, e.g. 50 and 1s.
+func (c *Client) updateRateLimit(h http.Header) {
+	limit, err := strconv.Atoi(h.Get("X-Rate-Limit-Limit"))
+	if err != nil {
+		return
+	}
+	interval, err := time.ParseDuration(h.Get("X-Rate-Limit-Interval"))
+	if err != nil {
+		return
+	}
+	c.limiter.SetRate(limit, interval)
 }
 
+// ErrNotFound is returned for a work which CrossRef doesn't know, e.g. a
+// DOI of another registration agency.
+var ErrNotFound = errors.New("not found")
+
 // CrossRef specific
 
-// Response is a CrossRef REST API response type.
+// Response is a CrossRef REST API response type. The message is
+// decoded according to the message type.
 type Response struct {
 	Status         string
-	MessageType    string `json:"message-type"`
-	MessageVersion string `json:"message-version"`
-	Message        interface{}
+	MessageType    string          `json:"message-type"`
+	MessageVersion string          `json:"message-version"`
+	Message        json.RawMessage `json:"message"`
+}
+
+// MalformedError is returned when a response doesn't follow the API
+// schema, e.g. it's not JSON, has a bad status or fields of unexpected
+// types. Missing fields are not an error.
+type MalformedError struct {
+	Reason string
+	Err    error
+}
+
+func (e *MalformedError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("malformed crossref response: %s: %v", e.Reason, e.Err)
+	}
+	return fmt.Sprintf("malformed crossref response: %s", e.Reason)
+}
+
+// Unwrap returns the underlying error.
+func (e *MalformedError) Unwrap() error {
+	return e.Err
+}
+
+// workMessage is the message of the "work" type. Only used fields are
+// decoded, all of them are optional.
+type workMessage struct {
+	DOI             string        `json:"DOI"`
+	Type            string        `json:"type"`
+	Title           []string      `json:"title"`
+	ContainerTitle  []string      `json:"container-title"`
+	Publisher       string        `json:"publisher"`
+	ReferenceCount  int           `json:"reference-count"`
+	Author          []authorEntry `json:"author"`
+	Issued          dateParts     `json:"issued"`
+	Published       dateParts     `json:"published"`
+	PublishedPrint  dateParts     `json:"published-print"`
+	PublishedOnline dateParts     `json:"published-online"`
+	Volume          string        `json:"volume"`
+	Issue           string        `json:"issue"`
+	Page            string        `json:"page"`
+	ISSN            []string      `json:"ISSN"`
+	ISBN            []string      `json:"ISBN"`
+	License         []struct {
+		URL            string `json:"URL"`
+		ContentVersion string `json:"content-version"`
+	} `json:"license"`
+	Abstract string                     `json:"abstract"`
+	Score    float64                    `json:"score"`
+	Relation map[string]relationEntries `json:"relation"`
+}
+
+type relationEntry struct {
+	IDType     string `json:"id-type"`
+	ID         string `json:"id"`
+	AssertedBy string `json:"asserted-by"`
+}
+
+// relationEntries is a list of related objects. Some records have a
+// single object instead of a list, it's decoded as a list of one.
+type relationEntries []relationEntry
+
+func (r *relationEntries) UnmarshalJSON(data []byte) error {
+	var list []relationEntry
+	if err := json.Unmarshal(data, &list); err == nil {
+		*r = list
+		return nil
+	}
+	var entry relationEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return fmt.Errorf("relation is neither an object nor an array of objects: %s", data)
+	}
+	*r = relationEntries{entry}
+	return nil
+}
+
+type authorEntry struct {
+	Given  string `json:"given"`
+	Family string `json:"family"`
+	// Name is used for organizations instead of given and family
+	// names.
+	Name               string `json:"name"`
+	ORCID              string `json:"ORCID"`
+	AuthenticatedORCID bool   `json:"authenticated-orcid"`
+	Sequence           string `json:"sequence"`
+	Affiliation        []struct {
+		Name string `json:"name"`
+	} `json:"affiliation"`
+}
+
+// dateParts is a partial date like {"date-parts": [[2018, 3, 1]]}, where
+// the month and day are optional. Unknown dates are [[null]].
+type dateParts struct {
+	DateParts [][]*int `json:"date-parts"`
+}
+
+func (d dateParts) date() Date {
+	if len(d.DateParts) == 0 {
+		return Date{}
+	}
+
+	var values [3]int
+	for i, v := range d.DateParts[0] {
+		if i >= len(values) || v == nil {
+			break
+		}
+		values[i] = *v
+	}
+
+	return Date{Year: values[0], Month: values[1], Day: values[2]}
 }
 
 // Work is a CrossRef work type.
 type Work struct {
 	Title           string
 	ReferencesCount int
-	Authors         []string
+	Authors         []Author
+
+	DOI string
+	// Type is a CrossRef work type, e.g. journal-article or
+	// proceedings-article.
+	Type string
+	// ContainerTitle is a title of the journal, proceedings or book the
+	// work is published in.
+	ContainerTitle string
+	Publisher      string
+	// Issued is the earliest known publication date.
+	Issued Date
+	// Published is the print publication date or the online one if the
+	// work is not printed.
+	Published Date
+	Volume    string
+	Issue     string
+	Page      string
+	ISSN      []string
+	ISBN      []string
+	// License holds URLs of licenses.
+	License []string
+	// Abstract is in JATS XML, e.g. <jats:p>…</jats:p>.
+	Abstract string
+	// Score is the relevance of the work to a query, it's set by
+	// SearchWorks only.
+	Score float64
+	// Relations maps relation types, e.g. is-preprint-of, has-preprint
+	// or is-version-of, to related objects.
+	Relations map[string][]Relation
 }
 
-// GetWork returns a work by DOI.
-func GetWork(c *Client, id DOI) (*Work, error) {
-	// TODO: rate limit check from headers
+// Relation types of preprints and their published versions.
+const (
+	IsPreprintOf = "is-preprint-of"
+	HasPreprint  = "has-preprint"
+)
+
+// Relation is an object related to a work.
+type Relation struct {
+	// IDType is a type of the identifier, e.g. doi, arxiv or uri.
+	IDType string
+	ID     string
+	// AssertedBy is "subject" if the relation is asserted by the owner
+	// of the work and "object" if by the owner of the related object.
+	AssertedBy string
+}
+
+// Author is a contributor of a work as CrossRef lists it.
+type Author struct {
+	Given  string
+	Family string
+	// Name is used for organizations instead of the given and family
+	// names.
+	Name string
+	// ORCID is the ORCID iD URL, e.g. http://orcid.org/0000-0002-0183-1282.
+	ORCID string
+	// AuthenticatedORCID is true if the author has confirmed the iD.
+	AuthenticatedORCID bool
+	Affiliations       []string
+	// Sequence is "first" for the first author and "additional" for
+	// others.
+	Sequence string
+}
 
-	path := fmt.Sprintf("%s/%s", c.WorksPath(), id)
-	req, err := http.NewRequest("GET", path, nil)
+// FullName returns the name of an organization or the given and family
+// names of a person.
+func (a Author) FullName() string {
+	if len(a.Name) > 0 {
+		return a.Name
+	}
+	return strings.TrimSpace(a.Given + " " + a.Family)
+}
+
+// Date is a partial date, CrossRef might omit the month and day.
+type Date struct {
+	Year  int
+	Month int
+	Day   int
+}
+
+// IsZero checks if the date is unknown.
+func (d Date) IsZero() bool {
+	return d.Year == 0
+}
+
+// GetWork returns a work by DOI.
+func GetWork(ctx context.Context, c *Client, id doi.DOI) (*Work, error) {
+	path := fmt.Sprintf("%s/%s", c.WorksPath(), url.PathEscape(string(id)))
+	resp, err := c.get(ctx, path)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("User-Agent", "bitbucket.org/iharsuvorau/crossref (mailto:ihar.suvorau@ut.ee)")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("failed to get %s: %v, %v", path, resp.StatusCode, err)
-	}
 	defer resp.Body.Close()
 	return decodeWork(resp.Body)
 }
 
-func decodeWork(r io.Reader) (*Work, error) {
-	resp := Response{}
-	err := json.NewDecoder(r).Decode(&resp)
+// Query is a search of works by bibliographic data.
+type Query struct {
+	// Bibliographic is free text like a title, year and venue.
+	Bibliographic string
+	// Author is names of the authors.
+	Author string
+	// Rows limits the amount of results, 20 results are returned by
+	// default.
+	Rows int
+}
+
+// SearchWorks returns works matching the query sorted by the relevance
+// score in descending order.
+func SearchWorks(ctx context.Context, c *Client, q Query) ([]*Work, error) {
+	params := url.Values{}
+	if len(q.Bibliographic) > 0 {
+		params.Set("query.bibliographic", q.Bibliographic)
+	}
+	if len(q.Author) > 0 {
+		params.Set("query.author", q.Author)
+	}
+	if len(params) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	if q.Rows > 0 {
+		params.Set("rows", strconv.Itoa(q.Rows))
+	}
+
+	resp, err := c.get(ctx, c.WorksPath().String()+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	list, err := decodeWorks(resp.Body)
 	if err != nil {
 		return nil, err
 	}
+	return list.Items, nil
+}
+
+// batchSize is the amount of DOIs filtered by one request of GetWorks,
+// it keeps URLs reasonably short.
+const batchSize = 50
+
+// GetWorks returns works by DOIs using as few requests as possible:
+// DOIs are filtered in batches, e.g. /works?filter=doi:a,doi:b, and
+// results are paged with a cursor. DOIs with commas can't be filtered,
+// so they are requested one by one after the batches. Works which are
+// not found are missing in the result, which is keyed by the requested
+// DOIs, only failed requests are errors.
+func GetWorks(ctx context.Context, c *Client, ids []doi.DOI) (map[doi.DOI]*Work, error) {
+	works := make(map[doi.DOI]*Work, len(ids))
+
+	// DOIs are case-insensitive, so the returned ones are matched to
+	// the requested ones in lower case
+	requested := make(map[string]doi.DOI, len(ids))
+	batch := []doi.DOI{}
+	single := []doi.DOI{}
+	for _, id := range ids {
+		key := strings.ToLower(string(id))
+		if _, ok := requested[key]; ok || len(id) == 0 {
+			continue
+		}
+		requested[key] = id
+
+		if strings.Contains(string(id), ",") {
+			single = append(single, id)
+			continue
+		}
+		batch = append(batch, id)
+	}
+
+	for start := 0; start < len(batch); start += batchSize {
+		end := start + batchSize
+		if end > len(batch) {
+			end = len(batch)
+		}
+
+		found, err := filterWorks(ctx, c, batch[start:end])
+		if err != nil {
+			return works, err
+		}
+		for _, w := range found {
+			if id, ok := requested[strings.ToLower(w.DOI)]; ok {
+				works[id] = w
+			}
+		}
+	}
+
+	for _, id := range single {
+		work, err := GetWork(ctx, c, id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return works, err
+		}
+		works[id] = work
+	}
+
+	return works, nil
+}
+
+// filterWorks requests works by DOIs following the cursor until all
+// results are received.
+func filterWorks(ctx context.Context, c *Client, ids []doi.DOI) ([]*Work, error) {
+	filters := make([]string, len(ids))
+	for i, id := range ids {
+		filters[i] = "doi:" + string(id)
+	}
+
+	params := url.Values{}
+	params.Set("filter", strings.Join(filters, ","))
+	params.Set("rows", strconv.Itoa(len(ids)))
+	params.Set("cursor", "*")
+
+	works := []*Work{}
+	for {
+		resp, err := c.get(ctx, c.WorksPath().String()+"?"+params.Encode())
+		if err != nil {
+			return nil, err
+		}
+		list, err := decodeWorks(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		works = append(works, list.Items...)
+
+		// the cursor is returned even after the last page
+		if len(list.Items) == 0 || len(works) >= list.TotalResults || len(list.NextCursor) == 0 {
+			break
+		}
+		params.Set("cursor", list.NextCursor)
+	}
+
+	return works, nil
+}
+
+func decodeWork(r io.Reader) (*Work, error) {
+	resp := Response{}
+	if err := json.NewDecoder(r).Decode(&resp); err != nil {
+		return nil, &MalformedError{Reason: "failed to decode the response", Err: err}
+	}
 	if resp.Status != "ok" {
-		return nil, fmt.Errorf("bad response status: %+v", resp)
+		return nil, &MalformedError{Reason: fmt.Sprintf("bad response status %q", resp.Status)}
 	}
 	if resp.MessageType != "work" {
-		return nil, fmt.Errorf("bad response type: %+v", resp)
-	}
-	workInt, ok := resp.Message.(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("failed work type conversion: %+v", resp.Message)
+		return nil, &MalformedError{Reason: fmt.Sprintf("bad message type %q", resp.MessageType)}
 	}
 
-	titleParts := workInt["title"].([]interface{})
-	var title string
-	for _, v := range titleParts {
-		title += v.(string)
+	msg := workMessage{}
+	if err := json.Unmarshal(resp.Message, &msg); err != nil {
+		return nil, &MalformedError{Reason: "failed to decode the work message", Err: err}
 	}
 
-	refcount := int(workInt["reference-count"].(float64))
+	return msg.work(), nil
+}
 
-	authorsInt := workInt["author"].([]interface{})
-	authors := []string{}
-	var name string
-	for _, v := range authorsInt {
-		author, ok := v.(map[string]interface{})
-		if !ok {
+func (m *workMessage) work() *Work {
+	authors := []Author{}
+	for _, a := range m.Author {
+		// give up here, because "family" is specified as required for
+		// persons
+		if len(a.Name) == 0 && len(a.Family) == 0 {
 			continue
 		}
-		name, ok = author["name"].(string)
-		if !ok { // trying another scheme, because the name have several schemes in API
-			lastName, ok := author["family"].(string)
-			if !ok { // give up here, because "family" is specified as required
-				continue
+		author := Author{
+			Given:              a.Given,
+			Family:             a.Family,
+			Name:               a.Name,
+			ORCID:              a.ORCID,
+			AuthenticatedORCID: a.AuthenticatedORCID,
+			Sequence:           a.Sequence,
+		}
+		for _, aff := range a.Affiliation {
+			if len(aff.Name) > 0 {
+				author.Affiliations = append(author.Affiliations, aff.Name)
 			}
-			firstName, _ := author["given"].(string)
-			name = fmt.Sprintf("%s %s", firstName, lastName)
 		}
-		authors = append(authors, name)
+		authors = append(authors, author)
 	}
 
 	work := Work{
-		Title:           title,
-		ReferencesCount: refcount,
+		Title:           strings.Join(m.Title, ""),
+		ReferencesCount: m.ReferenceCount,
 		Authors:         authors,
+		DOI:             m.DOI,
+		Type:            m.Type,
+		ContainerTitle:  strings.Join(m.ContainerTitle, ""),
+		Publisher:       m.Publisher,
+		Issued:          m.Issued.date(),
+		Volume:          m.Volume,
+		Issue:           m.Issue,
+		Page:            m.Page,
+		ISSN:            m.ISSN,
+		ISBN:            m.ISBN,
+		Abstract:        m.Abstract,
+		Score:           m.Score,
+	}
+
+	for _, d := range []dateParts{m.PublishedPrint, m.PublishedOnline, m.Published} {
+		if work.Published = d.date(); !work.Published.IsZero() {
+			break
+		}
+	}
+
+	for _, l := range m.License {
+		if len(l.URL) > 0 {
+			work.License = append(work.License, l.URL)
+		}
+	}
+
+	for t, entries := range m.Relation {
+		for _, e := range entries {
+			if len(e.ID) == 0 {
+				continue
+			}
+			if work.Relations == nil {
+				work.Relations = make(map[string][]Relation)
+			}
+			work.Relations[t] = append(work.Relations[t], Relation{IDType: e.IDType, ID: e.ID, AssertedBy: e.AssertedBy})
+		}
 	}
-	return &work, nil
+
+	return &work
+}
+
+// workList is the message of the "work-list" type.
+type workList struct {
+	TotalResults int
+	NextCursor   string
+	Items        []*Work
+}
+
+func decodeWorks(r io.Reader) (*workList, error) {
+	resp := Response{}
+	if err := json.NewDecoder(r).Decode(&resp); err != nil {
+		return nil, &MalformedError{Reason: "failed to decode the response", Err: err}
+	}
+	if resp.Status != "ok" {
+		return nil, &MalformedError{Reason: fmt.Sprintf("bad response status %q", resp.Status)}
+	}
+	if resp.MessageType != "work-list" {
+		return nil, &MalformedError{Reason: fmt.Sprintf("bad message type %q", resp.MessageType)}
+	}
+
+	msg := struct {
+		TotalResults int           `json:"total-results"`
+		NextCursor   string        `json:"next-cursor"`
+		Items        []workMessage `json:"items"`
+	}{}
+	if err := json.Unmarshal(resp.Message, &msg); err != nil {
+		return nil, &MalformedError{Reason: "failed to decode the work list message", Err: err}
+	}
+
+	list := workList{
+		TotalResults: msg.TotalResults,
+		NextCursor:   msg.NextCursor,
+		Items:        make([]*Work, len(msg.Items)),
+	}
+	for i := range msg.Items {
+		list.Items[i] = msg.Items[i].work()
+	}
+
+	return &list, nil
 }
@@ -1,9 +1,18 @@
 package crossref
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
 )
 
 func TestNew(t *testing.T) {
@@ -58,8 +67,8 @@ func TestGetWork(t *testing.T) {
 	}
 
 	for _, v := range ids {
-		id := DOI(v)
-		work, err := GetWork(c, id)
+		id := doi.DOI(v)
+		work, err := GetWork(context.Background(), c, id)
 		if err != nil {
 			t.Logf("%+v", work)
 			t.Fatal(err)
@@ -90,69 +99,410 @@ func Test_decodeWork(t *testing.T) {
 	}
 }
 
-func TestDOIFromURL(t *testing.T) {
-	type args struct {
-		s string
-	}
+const testWorkJSON = `{"status":"ok","message-type":"work","message":{"title":["Test Work"],"reference-count":1,"author":[{"given":"John","family":"Doe"}]}}`
+
+func TestWithMailto(t *testing.T) {
 	tests := []struct {
-		name    string
-		args    args
-		want    DOI
-		wantErr bool
+		name   string
+		mailto string
+		want   string
 	}{
 		{
-			name:    "A",
-			args:    args{s: "https://doi.org/10.3390/act7010007"},
-			want:    DOI("10.3390/act7010007"),
-			wantErr: false,
+			name:   "A",
+			mailto: "",
+			want:   "ims-publications (https://bitbucket.org/iharsuvorau/ims-publications)",
 		},
 		{
-			name:    "B",
-			args:    args{s: "https://doi.org/10.3390/act7010007/"},
-			want:    DOI("10.3390/act7010007"),
-			wantErr: false,
+			name:   "B",
+			mailto: "admin@example.org",
+			want:   "ims-publications (https://bitbucket.org/iharsuvorau/ims-publications; mailto:admin@example.org)",
 		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("User-Agent")
+				fmt.Fprint(w, testWorkJSON)
+			}))
+			defer srv.Close()
+
+			c, err := New(srv.URL, WithMailto(tt.mailto))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = GetWork(context.Background(), c, doi.DOI("10.1000/test")); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("User-Agent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetWork_rateLimit(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-Rate-Limit-Limit", "50")
+		w.Header().Set("X-Rate-Limit-Interval", "1s")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/missing"):
+			http.NotFound(w, r)
+		case requests <= 2:
+			// overloaded twice
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			fmt.Fprint(w, testWorkJSON)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, WithRetries(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	work, err := GetWork(context.Background(), c, doi.DOI("10.1000/test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if work.Title != "Test Work" || len(work.Authors) != 1 || work.Authors[0].FullName() != "John Doe" {
+		t.Errorf("unexpected work: %+v", work)
+	}
+	if requests != 3 {
+		t.Errorf("want 3 requests, got %v", requests)
+	}
+	if got := c.limiter.Interval(); got != time.Second/50 {
+		t.Errorf("want the limiter interval %v, got %v", time.Second/50, got)
+	}
+
+	requests = 10
+	if _, err = GetWork(context.Background(), c, doi.DOI("missing")); err == nil {
+		t.Error("want an error for the missing work")
+	}
+	if requests != 11 {
+		t.Errorf("missing work must not be retried, got %v requests", requests-10)
+	}
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(w, testWorkJSON)
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, WithHTTPClient(&http.Client{Timeout: 10 * time.Millisecond}), WithRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetWork(context.Background(), c, doi.DOI("10.1000/test")); err == nil {
+		t.Error("want a timeout error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c, err = New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetWork(ctx, c, doi.DOI("10.1000/test")); err == nil {
+		t.Error("want an error of the canceled context")
+	}
+}
+
+func Test_decodeWork_metadata(t *testing.T) {
+	const data = `{"status":"ok","message-type":"work","message":{
+		"DOI":"10.3390/act7010007",
+		"type":"journal-article",
+		"title":["Soft Actuators"],
+		"container-title":["Actuators"],
+		"publisher":"MDPI AG",
+		"reference-count":42,
+		"author":[{"given":"John","family":"Doe","ORCID":"http://orcid.org/0000-0002-0183-1282","authenticated-orcid":true,"sequence":"first","affiliation":[{"name":"University of Tartu"}]}],
+		"issued":{"date-parts":[[2018,2,6]]},
+		"published-online":{"date-parts":[[2018,2,6]]},
+		"published-print":{"date-parts":[[2018,3]]},
+		"volume":"7","issue":"1","page":"7",
+		"ISSN":["2076-0825"],
+		"license":[{"URL":"https://creativecommons.org/licenses/by/4.0/","content-version":"vor"}],
+		"abstract":"<jats:p>Abstract.</jats:p>"}}`
+
+	got, err := decodeWork(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Work{
+		Title:           "Soft Actuators",
+		ReferencesCount: 42,
+		Authors: []Author{{
+			Given:              "John",
+			Family:             "Doe",
+			ORCID:              "http://orcid.org/0000-0002-0183-1282",
+			AuthenticatedORCID: true,
+			Affiliations:       []string{"University of Tartu"},
+			Sequence:           "first",
+		}},
+		DOI:            "10.3390/act7010007",
+		Type:           "journal-article",
+		ContainerTitle: "Actuators",
+		Publisher:      "MDPI AG",
+		Issued:         Date{Year: 2018, Month: 2, Day: 6},
+		Published:      Date{Year: 2018, Month: 3},
+		Volume:         "7",
+		Issue:          "1",
+		Page:           "7",
+		ISSN:           []string{"2076-0825"},
+		License:        []string{"https://creativecommons.org/licenses/by/4.0/"},
+		Abstract:       "<jats:p>Abstract.</jats:p>",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeWork() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_decodeWork_relations(t *testing.T) {
+	const data = `{"status":"ok","message-type":"work","message":{
+		"DOI":"10.1101/2019.01.01.000001",
+		"type":"posted-content",
+		"relation":{
+			"is-preprint-of":[{"id-type":"doi","id":"10.3390/act7010007","asserted-by":"subject"}],
+			"is-version-of":{"id-type":"arxiv","id":"1801.00001","asserted-by":"object"},
+			"cites":[]}}}`
+
+	got, err := decodeWork(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]Relation{
+		IsPreprintOf:    {{IDType: "doi", ID: "10.3390/act7010007", AssertedBy: "subject"}},
+		"is-version-of": {{IDType: "arxiv", ID: "1801.00001", AssertedBy: "object"}},
+	}
+	if !reflect.DeepEqual(got.Relations, want) {
+		t.Errorf("Relations = %+v, want %+v", got.Relations, want)
+	}
+}
+
+func Test_decodeWork_partial(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		want          *Work
+		wantMalformed bool
+	}{
 		{
-			name:    "C",
-			args:    args{s: "doi.org/10.3390/act7010007/"},
-			want:    DOI("10.3390/act7010007"),
-			wantErr: false,
+			name: "A",
+			data: `{"status":"ok","message-type":"work","message":{"DOI":"10.1000/editorial","type":"journal-article"}}`,
+			want: &Work{Authors: []Author{}, DOI: "10.1000/editorial", Type: "journal-article"},
 		},
 		{
-			name:    "D",
-			args:    args{s: "10.1000/123456"},
-			want:    DOI("10.1000/123456"),
-			wantErr: false,
+			name: "B",
+			data: `{"status":"ok","message-type":"work","message":{"author":[{"name":"Consortium"},{"given":"John"},{"family":"Doe"}],"issued":{"date-parts":[[null]]}}}`,
+			want: &Work{Authors: []Author{{Name: "Consortium"}, {Family: "Doe"}}},
 		},
 		{
-			name:    "E",
-			args:    args{s: "10.1038/issn.1476-4687"},
-			want:    DOI("10.1038/issn.1476-4687"),
-			wantErr: false,
+			name:          "C",
+			data:          `{"status":"ok","message-type":"work","message":{"title":"not an array"}}`,
+			wantMalformed: true,
 		},
 		{
-			name:    "F",
-			args:    args{s: "978-12345-99990"},
-			want:    DOI(""),
-			wantErr: true,
+			name:          "D",
+			data:          `{"status":"failed","message-type":"route-not-found","message":"not found"}`,
+			wantMalformed: true,
 		},
 		{
-			name:    "G",
-			args:    args{s: "10.978.86123/45678"},
-			want:    DOI("10.978.86123/45678"),
-			wantErr: false,
+			name:          "E",
+			data:          `Resource not found.`,
+			wantMalformed: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := DOIFromURL(tt.args.s)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("DOIFromURL() error = %v, wantErr %v", err, tt.wantErr)
-				return
+			got, err := decodeWork(strings.NewReader(tt.data))
+			if _, ok := err.(*MalformedError); ok != tt.wantMalformed {
+				t.Fatalf("decodeWork() error = %v, wantMalformed %v", err, tt.wantMalformed)
 			}
-			if got != tt.want {
-				t.Errorf("DOIFromURL() = %v, want %v", got, tt.want)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeWork() = %+v, want %+v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestSearchWorks(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/works" {
+			http.NotFound(w, r)
+			return
+		}
+		query = r.URL.RawQuery
+		fmt.Fprint(w, `{"status":"ok","message-type":"work-list","message":{"total-results":2,"items":[
+			{"DOI":"10.1000/a","title":["Soft Actuators"],"score":75.5},
+			{"DOI":"10.1000/b","title":["Hard Actuators"],"score":12.1}]}}`)
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	works, err := SearchWorks(context.Background(), c, Query{Bibliographic: "Soft Actuators 2018", Author: "Doe", Rows: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "query.author=Doe&query.bibliographic=Soft+Actuators+2018&rows=2"; query != want {
+		t.Errorf("query = %q, want %q", query, want)
+	}
+	if len(works) != 2 || works[0].DOI != "10.1000/a" || works[0].Score != 75.5 || works[1].Title != "Hard Actuators" {
+		t.Errorf("unexpected works: %+v", works)
+	}
+
+	if _, err = SearchWorks(context.Background(), c, Query{}); err == nil {
+		t.Error("want an error for the empty query")
+	}
+}
+
+func TestGetWorks(t *testing.T) {
+	const pageSize = 40
+
+	var filterRequests, workRequests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/works" {
+			workRequests++
+			fmt.Fprint(w, `{"status":"ok","message-type":"work","message":{"DOI":"10.1000/a,b","title":["Comma"]}}`)
+			return
+		}
+		filterRequests++
+
+		// the server returns lower-case DOIs, every even one is missing
+		var found []string
+		for _, f := range strings.Split(r.URL.Query().Get("filter"), ",") {
+			doi := strings.ToLower(strings.TrimPrefix(f, "doi:"))
+			var n int
+			fmt.Sscanf(doi, "10.1000/w%d", &n)
+			if n%2 == 1 {
+				found = append(found, doi)
+			}
+		}
+
+		start := 0
+		if cursor := r.URL.Query().Get("cursor"); cursor != "*" {
+			fmt.Sscanf(cursor, "page%d", &start)
+		}
+		end := start + pageSize
+		if end > len(found) {
+			end = len(found)
+		}
+
+		items := []string{}
+		for _, doi := range found[start:end] {
+			items = append(items, fmt.Sprintf(`{"DOI":%q,"title":[%q]}`, doi, doi))
+		}
+		fmt.Fprintf(w, `{"status":"ok","message-type":"work-list","message":{"total-results":%d,"next-cursor":"page%d","items":[%s]}}`,
+			len(found), end, strings.Join(items, ","))
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []doi.DOI{"10.1000/a,b", "10.1000/W1"}
+	for i := 1; i <= 120; i++ {
+		ids = append(ids, doi.DOI(fmt.Sprintf("10.1000/w%d", i)))
+	}
+
+	works, err := GetWorks(context.Background(), c, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 60 odd DOIs and the one with a comma
+	if len(works) != 61 {
+		t.Errorf("want 61 works, got %v", len(works))
+	}
+	if w, ok := works["10.1000/W1"]; !ok || w.DOI != "10.1000/w1" {
+		t.Errorf("want the work keyed by the requested DOI, got %+v", w)
+	}
+	if _, ok := works["10.1000/w2"]; ok {
+		t.Error("missing works must not be returned")
+	}
+	if w, ok := works["10.1000/a,b"]; !ok || w.Title != "Comma" {
+		t.Errorf("want the work with a comma, got %+v", w)
+	}
+
+	// 120 unique DOIs make 3 batches of 25 found works each at most, so
+	// each batch is a single page; the DOI with a comma is requested alone
+	if filterRequests != 3 || workRequests != 1 {
+		t.Errorf("want 3 filter and 1 work requests, got %v and %v", filterRequests, workRequests)
+	}
+}
+
+func TestGetWorks_notFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/works" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok","message-type":"work-list","message":{"total-results":1,"items":[{"DOI":"10.1000/a"}]}}`)
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	works, err := GetWorks(context.Background(), c, []doi.DOI{"10.1000/x,y", "10.1000/a"})
+	if err != nil {
+		t.Fatalf("a DOI which is not found must not be an error, got %v", err)
+	}
+	if len(works) != 1 || works["10.1000/a"] == nil {
+		t.Errorf("want the work of the batch, got %+v", works)
+	}
+
+	if _, err = GetWork(context.Background(), c, "10.1000/x,y"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+}
+
+func Test_filterWorks_paging(t *testing.T) {
+	var cursors []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cursor := r.URL.Query().Get("cursor")
+		cursors = append(cursors, cursor)
+		switch cursor {
+		case "*":
+			fmt.Fprint(w, `{"status":"ok","message-type":"work-list","message":{"total-results":3,"next-cursor":"c1","items":[{"DOI":"10.1000/1"},{"DOI":"10.1000/2"}]}}`)
+		case "c1":
+			fmt.Fprint(w, `{"status":"ok","message-type":"work-list","message":{"total-results":3,"next-cursor":"c2","items":[{"DOI":"10.1000/3"}]}}`)
+		default:
+			fmt.Fprint(w, `{"status":"ok","message-type":"work-list","message":{"total-results":3,"next-cursor":"c3","items":[]}}`)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	works, err := filterWorks(context.Background(), c, []doi.DOI{"10.1000/1", "10.1000/2", "10.1000/3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(works) != 3 {
+		t.Errorf("want 3 works, got %v", len(works))
+	}
+	if !reflect.DeepEqual(cursors, []string{"*", "c1"}) {
+		t.Errorf("unexpected cursors: %v", cursors)
+	}
+}
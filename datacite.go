@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"bitbucket.org/iharsuvorau/ims-publications/cache"
+	"bitbucket.org/iharsuvorau/ims-publications/datacite"
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
+	"bitbucket.org/iharsuvorau/ims-publications/orcid"
+)
+
+// dataCiteWork returns the DataCite record of the ORCID work or nil if
+// the work has no DOI or it could not be fetched.
+func dataCiteWork(ctx context.Context, w *orcid.Work, dc *datacite.Client, c *cache.Cache, logger *log.Logger) *datacite.Work {
+	id, err := w.DOI()
+	if err != nil {
+		return nil
+	}
+
+	work, err := getDataCiteWork(ctx, dc, c, id, logger)
+	if err != nil {
+		logger.Printf("datacite fetch error: %v", err)
+		return nil
+	}
+
+	return work
+}
+
+// getDataCiteWork returns a DataCite record from the cache if it's
+// fresh, otherwise the record is downloaded and cached. DOIs which
+// DataCite doesn't know are cached as null, so they aren't requested
+// again until the entry is obsolete, and datacite.ErrNotFound is
+// returned for them. The cache is optional.
+func getDataCiteWork(ctx context.Context, dc *datacite.Client, c *cache.Cache, id doi.DOI, logger *log.Logger) (*datacite.Work, error) {
+	key := dataciteCacheKey(id)
+
+	var work *datacite.Work
+	ok, err := readCachedJSON(c, key, &work)
+	if err != nil {
+		logger.Printf("failed to read the cached datacite work %s: %v", id, err)
+	}
+	if ok {
+		if work == nil {
+			return nil, fmt.Errorf("datacite work %s: %w", id, datacite.ErrNotFound)
+		}
+		return work, nil
+	}
+
+	logger.Printf("datacite fetch: %s", id)
+	work, err = datacite.GetWork(ctx, dc, id)
+	if errors.Is(err, datacite.ErrNotFound) {
+		if err := writeCachedJSON(c, key, nil); err != nil {
+			logger.Printf("failed to cache the missing datacite work %s: %v", id, err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = writeCachedJSON(c, key, work); err != nil {
+		logger.Printf("failed to cache the datacite work %s: %v", id, err)
+	}
+
+	return work, nil
+}
+
+func contributorsFromDataCite(work *datacite.Work) []*orcid.Contributor {
+	contribs := []*orcid.Contributor{}
+	for i, v := range work.Creators {
+		c := &orcid.Contributor{
+			Name:       v.FullName(),
+			GivenName:  v.Given,
+			FamilyName: v.Family,
+			Sequence:   "additional",
+			Role:       "author",
+		}
+		if i == 0 {
+			c.Sequence = "first"
+		}
+		if len(v.ORCID) > 0 {
+			if id, err := orcid.IDFromURL(v.ORCID); err == nil {
+				c.ORCID = id
+			}
+		}
+		contribs = append(contribs, c)
+	}
+	return contribs
+}
+
+// completeWithDataCite fills the journal title, publication year and
+// type of the ORCID work from the DataCite record if they are missing.
+// The container, e.g. a repository, serves as the journal title.
+func completeWithDataCite(w *orcid.Work, work *datacite.Work) {
+	container := work.Container
+	if len(container) == 0 {
+		container = work.Publisher
+	}
+	completeWork(w, container, work.PublicationYear, 0, 0, dataCiteTypes[work.ResourceTypeGeneral])
+}
+
+// dataCiteTypes maps general DataCite resource types to ORCID work
+// types, types without a counterpart are left as they are in ORCID.
+var dataCiteTypes = map[string]string{
+	"Dataset":         "data-set",
+	"Software":        "software",
+	"JournalArticle":  "journal-article",
+	"ConferencePaper": "conference-paper",
+	"Preprint":        "preprint",
+	"Report":          "report",
+	"Book":            "book",
+	"BookChapter":     "book-chapter",
+	"Dissertation":    "dissertation",
+}
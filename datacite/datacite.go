@@ -0,0 +1,267 @@
+// Package datacite provides a wrapper on top of DataCite REST API, read
+// more at https://support.datacite.org/docs/api. DataCite registers
+// DOIs of datasets, software and other research outputs, e.g. the ones
+// published on Zenodo.
+package datacite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
+	"bitbucket.org/iharsuvorau/ims-publications/internal/throttle"
+)
+
+// Client is a DataCite client which handles all further requests.
+type Client struct {
+	apiBase    *url.URL
+	doisPath   *url.URL
+	backoff    throttle.Backoff
+	httpClient *http.Client
+}
+
+// Option configures a client.
+type Option func(*Client)
+
+// WithRetries sets the amount of retries of a request failed because of
+// a network error, the 429 or 5xx status. Three retries are made by
+// default.
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		c.backoff.Retries = n
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for all requests, e.g. to
+// configure timeouts, a proxy or a transport. http.DefaultClient is used
+// by default.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		if hc != nil {
+			c.httpClient = hc
+		}
+	}
+}
+
+// New returns a new client with generated internal API URLs, e.g. for
+// https://api.datacite.org.
+func New(apiBase string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(apiBase, "/") + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := url.Parse("dois")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		apiBase:    u,
+		doisPath:   u.ResolveReference(d),
+		backoff:    throttle.Backoff{Retries: 3, Min: time.Second, Max: time.Second * 30},
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// APIBase returns the base URL.
+func (c *Client) APIBase() *url.URL {
+	return c.apiBase
+}
+
+// DOIsPath returns the DOIs URL.
+func (c *Client) DOIsPath() *url.URL {
+	return c.doisPath
+}
+
+// get requests the URL retrying transient failures until the context is
+// done. The caller must close the body of the response.
+func (c *Client) get(ctx context.Context, uri string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.api+json")
+
+	var resp *http.Response
+	for retry := 0; ; retry++ {
+		resp, err = c.httpClient.Do(req)
+		if err == nil && !throttle.Retryable(resp.StatusCode) || retry >= c.backoff.Retries {
+			break
+		}
+
+		delay := c.backoff.Delay(retry)
+		if err == nil {
+			if d, ok := throttle.RetryAfter(resp.Header); ok {
+				delay = d
+			}
+			resp.Body.Close()
+		}
+		if err = throttle.Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %v", uri, err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to get %s: %w", uri, ErrNotFound)
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to get %s: %v", uri, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// ErrNotFound is returned for a DOI which DataCite doesn't know.
+var ErrNotFound = errors.New("not found")
+
+// Work is a DataCite DOI record.
+type Work struct {
+	DOI      string
+	Title    string
+	Creators []Creator
+	// Container is a title of the series or repository the work belongs
+	// to, e.g. Zenodo.
+	Container       string
+	Publisher       string
+	PublicationYear int
+	// ResourceTypeGeneral is a controlled type, e.g. Dataset, Software
+	// or Text.
+	ResourceTypeGeneral string
+	// ResourceType is a free text refinement of the general type.
+	ResourceType string
+	URL          string
+}
+
+// Creator is a person or an organization who made the work.
+type Creator struct {
+	// Name is "Family, Given" for persons.
+	Name   string
+	Given  string
+	Family string
+	// Organizational is true for organizations.
+	Organizational bool
+	// ORCID is the ORCID iD URL of a person if it's known.
+	ORCID string
+}
+
+// FullName returns the given and family names of a person or the name
+// of an organization.
+func (c Creator) FullName() string {
+	if len(c.Family) > 0 {
+		return strings.TrimSpace(c.Given + " " + c.Family)
+	}
+	return c.Name
+}
+
+// GetWork returns a work by DOI.
+func GetWork(ctx context.Context, c *Client, id doi.DOI) (*Work, error) {
+	// slashes are the part of DOIs, which are accepted unescaped
+	path := fmt.Sprintf("%s/%s", c.DOIsPath(), strings.ReplaceAll(url.PathEscape(string(id)), "%2F", "/"))
+	resp, err := c.get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return decodeWork(resp.Body)
+}
+
+// doiRecord is a JSON:API document of a DOI. Only used attributes are
+// decoded, all of them are optional.
+type doiRecord struct {
+	Data struct {
+		ID         string `json:"id"`
+		Type       string `json:"type"`
+		Attributes struct {
+			DOI      string `json:"doi"`
+			Creators []struct {
+				Name            string `json:"name"`
+				NameType        string `json:"nameType"`
+				GivenName       string `json:"givenName"`
+				FamilyName      string `json:"familyName"`
+				NameIdentifiers []struct {
+					NameIdentifier       string `json:"nameIdentifier"`
+					NameIdentifierScheme string `json:"nameIdentifierScheme"`
+				} `json:"nameIdentifiers"`
+			} `json:"creators"`
+			Titles []struct {
+				Title     string `json:"title"`
+				TitleType string `json:"titleType"`
+			} `json:"titles"`
+			Container struct {
+				Title string `json:"title"`
+			} `json:"container"`
+			Publisher       string `json:"publisher"`
+			PublicationYear int    `json:"publicationYear"`
+			Types           struct {
+				ResourceTypeGeneral string `json:"resourceTypeGeneral"`
+				ResourceType        string `json:"resourceType"`
+			} `json:"types"`
+			URL string `json:"url"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+func decodeWork(r io.Reader) (*Work, error) {
+	rec := doiRecord{}
+	if err := json.NewDecoder(r).Decode(&rec); err != nil {
+		return nil, fmt.Errorf("failed to decode the DataCite record: %v", err)
+	}
+	if rec.Data.Type != "dois" {
+		return nil, fmt.Errorf("bad record type: %q", rec.Data.Type)
+	}
+
+	attrs := rec.Data.Attributes
+	work := Work{
+		DOI:                 attrs.DOI,
+		Container:           attrs.Container.Title,
+		Publisher:           attrs.Publisher,
+		PublicationYear:     attrs.PublicationYear,
+		ResourceTypeGeneral: attrs.Types.ResourceTypeGeneral,
+		ResourceType:        attrs.Types.ResourceType,
+		URL:                 attrs.URL,
+	}
+
+	// the main title has no type, others are subtitles, translations
+	// and so on
+	for _, t := range attrs.Titles {
+		if len(t.TitleType) == 0 {
+			work.Title = t.Title
+			break
+		}
+	}
+
+	for _, v := range attrs.Creators {
+		creator := Creator{
+			Name:           v.Name,
+			Given:          v.GivenName,
+			Family:         v.FamilyName,
+			Organizational: v.NameType == "Organizational",
+		}
+		for _, id := range v.NameIdentifiers {
+			if id.NameIdentifierScheme == "ORCID" {
+				creator.ORCID = id.NameIdentifier
+			}
+		}
+		work.Creators = append(work.Creators, creator)
+	}
+
+	return &work, nil
+}
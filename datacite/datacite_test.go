@@ -0,0 +1,121 @@
+package datacite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
+)
+
+const testRecord = `{"data": {
+  "id": "10.5281/zenodo.1234",
+  "type": "dois",
+  "attributes": {
+    "doi": "10.5281/zenodo.1234",
+    "creators": [
+      {"name": "Doe, Jane", "nameType": "Personal", "givenName": "Jane", "familyName": "Doe",
+       "nameIdentifiers": [{"nameIdentifier": "https://orcid.org/0000-0002-0183-1282", "nameIdentifierScheme": "ORCID"}]},
+      {"name": "Soft Robotics Lab", "nameType": "Organizational"}
+    ],
+    "titles": [{"title": "Untertitel", "titleType": "TranslatedTitle"}, {"title": "Measurements of Soft Actuators"}],
+    "publisher": "Zenodo",
+    "publicationYear": 2019,
+    "types": {"resourceTypeGeneral": "Dataset", "resourceType": "Measurements"},
+    "url": "https://zenodo.org/record/1234"
+  }
+}}`
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		apiBase string
+		want    []string
+	}{
+		{
+			name:    "A",
+			apiBase: "https://api.datacite.org",
+			want:    []string{"https://api.datacite.org/", "https://api.datacite.org/dois"},
+		},
+		{
+			name:    "B",
+			apiBase: "https://api.datacite.org/",
+			want:    []string{"https://api.datacite.org/", "https://api.datacite.org/dois"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.apiBase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.APIBase().String() != tt.want[0] || got.DOIsPath().String() != tt.want[1] {
+				t.Errorf("New() = %v, %v, want %v", got.APIBase(), got.DOIsPath(), tt.want)
+			}
+		})
+	}
+}
+
+func Test_decodeWork(t *testing.T) {
+	got, err := decodeWork(strings.NewReader(testRecord))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Work{
+		DOI:   "10.5281/zenodo.1234",
+		Title: "Measurements of Soft Actuators",
+		Creators: []Creator{
+			{Name: "Doe, Jane", Given: "Jane", Family: "Doe", ORCID: "https://orcid.org/0000-0002-0183-1282"},
+			{Name: "Soft Robotics Lab", Organizational: true},
+		},
+		Publisher:           "Zenodo",
+		PublicationYear:     2019,
+		ResourceTypeGeneral: "Dataset",
+		ResourceType:        "Measurements",
+		URL:                 "https://zenodo.org/record/1234",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeWork() = %+v, want %+v", got, want)
+	}
+	if got.Creators[0].FullName() != "Jane Doe" || got.Creators[1].FullName() != "Soft Robotics Lab" {
+		t.Errorf("unexpected full names: %+v", got.Creators)
+	}
+
+	if _, err = decodeWork(strings.NewReader(`{"errors":[{"status":"404","title":"The resource you are looking for doesn't exist."}]}`)); err == nil {
+		t.Error("want an error for the error document")
+	}
+}
+
+func TestGetWork(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dois/10.5281/zenodo.1234" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, testRecord)
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, WithRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	work, err := GetWork(context.Background(), c, doi.DOI("10.5281/zenodo.1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if work.Title != "Measurements of Soft Actuators" {
+		t.Errorf("unexpected work: %+v", work)
+	}
+
+	if _, err = GetWork(context.Background(), c, doi.DOI("10.5281/missing")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want ErrNotFound for the missing DOI, got %v", err)
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
+	"bitbucket.org/iharsuvorau/ims-publications/orcid"
+)
+
+// dedupIDTypes are external identifiers which identify a single work,
+// a shared one makes works duplicates. ISSN, ISBN and alike identify
+// venues, so they are not considered.
+var dedupIDTypes = map[string]bool{
+	"doi":    true,
+	"eid":    true,
+	"arxiv":  true,
+	"wosuid": true,
+	"pmid":   true,
+}
+
+const (
+	// dedupTitleThreshold is the minimal title similarity of works
+	// without a shared identifier to be duplicates.
+	dedupTitleThreshold = 0.9
+	// dedupYearDistance is the maximal difference of publication years
+	// of duplicates, online and print versions are often a year apart.
+	dedupYearDistance = 1
+)
+
+// dedupMerge is a report of works merged into one.
+type dedupMerge struct {
+	// Kept is the work with the richest metadata which the others are
+	// merged into.
+	Kept   *orcid.Work
+	Merged []*orcid.Work
+	// Reasons explain why each of the merged works is a duplicate.
+	Reasons []string
+}
+
+func (m dedupMerge) String() string {
+	parts := make([]string, len(m.Merged))
+	for i, w := range m.Merged {
+		parts[i] = fmt.Sprintf("%q (%s)", w.Title, m.Reasons[i])
+	}
+	return fmt.Sprintf("merged into %q: %s", m.Kept.Title, strings.Join(parts, ", "))
+}
+
+// arXivVersion matches a version suffix of an arXiv identifier.
+var arXivVersion = regexp.MustCompile(`v[0-9]+$`)
+
+// externalIDKey returns a normalized identifier of the type used to
+// compare works or an empty string if the identifier is not used for
+// deduplication.
+func externalIDKey(id orcid.ExternalID) string {
+	t := strings.ToLower(id.Type)
+	if !dedupIDTypes[t] {
+		return ""
+	}
+
+	v := strings.ToLower(strings.TrimSpace(id.Value))
+	switch t {
+	case "doi":
+		parsed, err := doi.Parse(id.Value)
+		if err != nil {
+			parsed, err = doi.Parse(string(id.URL))
+		}
+		if err != nil {
+			return ""
+		}
+		v = parsed.String()
+	case "arxiv":
+		// versions of a preprint are the same work
+		v = strings.TrimPrefix(v, "arxiv:")
+		v = arXivVersion.ReplaceAllString(v, "")
+	case "eid":
+		v = strings.TrimPrefix(v, "2-s2.0-")
+	case "wosuid":
+		v = strings.TrimPrefix(v, "wos:")
+	}
+	if len(v) == 0 {
+		return ""
+	}
+	return t + ":" + v
+}
+
+// dedupInfo is what works are compared by, it's computed once per work.
+type dedupInfo struct {
+	year     int
+	keys     []string
+	doi      doi.DOI
+	preprint bool
+	words    map[string]bool
+}
+
+func newDedupInfo(w *orcid.Work) dedupInfo {
+	info := dedupInfo{year: w.Year, preprint: isPreprint(w), words: titleWords(string(w.Title))}
+	for _, id := range w.ExternalIDs {
+		if k := externalIDKey(id); len(k) > 0 {
+			info.keys = append(info.keys, k)
+		}
+	}
+	info.doi, _ = w.DOI()
+	return info
+}
+
+// duplicateReason checks if the works are the same work and returns the
+// reason or an empty string. Works with different DOIs are never
+// duplicates even if their titles are alike, e.g. a conference paper and
+// its extended journal version. A preprint is not a duplicate of its
+// published version, they are linked by linkPreprints.
+func duplicateReason(a, b *orcid.Work) string {
+	return newDedupInfo(a).duplicateReason(newDedupInfo(b))
+}
+
+func (a dedupInfo) duplicateReason(b dedupInfo) string {
+	if a.preprint != b.preprint {
+		return ""
+	}
+
+	for _, ka := range a.keys {
+		for _, kb := range b.keys {
+			if ka == kb {
+				return "shared " + ka
+			}
+		}
+	}
+
+	if len(a.doi) > 0 && len(b.doi) > 0 && a.doi != b.doi {
+		return ""
+	}
+
+	if a.year > 0 && b.year > 0 {
+		distance := a.year - b.year
+		if distance < 0 {
+			distance = -distance
+		}
+		if distance > dedupYearDistance {
+			return ""
+		}
+	}
+
+	if sim := wordsSimilarity(a.words, b.words); sim >= dedupTitleThreshold {
+		return fmt.Sprintf("title similarity %.2f", sim)
+	}
+	return ""
+}
+
+// metadataRichness is the amount of known metadata fields of the work
+// used to pick the best one of duplicates.
+func metadataRichness(w *orcid.Work) int {
+	n := 0
+	if _, err := w.DOI(); err == nil {
+		// a DOI brings a resolvable link, so it weighs more
+		n += 3
+	}
+	if len(w.Contributors) > 0 {
+		n += 2
+	}
+	if len(w.JournalTitle) > 0 {
+		n++
+	}
+	if w.Year > 0 {
+		n++
+	}
+	if w.Month > 0 {
+		n++
+	}
+	if w.Day > 0 {
+		n++
+	}
+	if len(w.Type) > 0 && w.Type != "other" {
+		n++
+	}
+	if w.Citation != nil && len(w.Citation.Value) > 0 {
+		n++
+	}
+	if len(w.URI) > 0 {
+		n++
+	}
+	return n + len(w.ExternalIDs)
+}
+
+// mergeWork fills fields of the work missing in it from the duplicate
+// and adds external identifiers which it doesn't have.
+func mergeWork(w, dup *orcid.Work) {
+	if len(w.Contributors) == 0 {
+		w.Contributors = dup.Contributors
+	}
+	if w.Year == 0 {
+		w.Year, w.Month, w.Day = dup.Year, dup.Month, dup.Day
+	}
+	completeWork(w, dup.JournalTitle, 0, 0, 0, dup.Type)
+	if w.Citation == nil {
+		w.Citation = dup.Citation
+	}
+	if len(w.URI) == 0 {
+		w.URI = dup.URI
+	}
+	if len(w.DoiURI) == 0 {
+		w.DoiURI = dup.DoiURI
+	}
+
+	for _, p := range dup.Preprints {
+		known := false
+		for _, wp := range w.Preprints {
+			if wp == p || len(duplicateReason(wp, p)) > 0 {
+				known = true
+				break
+			}
+		}
+		if !known {
+			w.Preprints = append(w.Preprints, p)
+		}
+	}
+
+	for _, m := range dup.Members {
+		known := false
+		for _, wm := range w.Members {
+			if wm == m {
+				known = true
+				break
+			}
+		}
+		if !known {
+			w.Members = append(w.Members, m)
+		}
+	}
+	sort.Strings(w.Members)
+
+	known := map[string]bool{}
+	for _, id := range w.ExternalIDs {
+		known[strings.ToLower(id.Type)+":"+strings.ToLower(id.Value)] = true
+		if k := externalIDKey(id); len(k) > 0 {
+			known[k] = true
+		}
+	}
+	for _, id := range dup.ExternalIDs {
+		k := externalIDKey(id)
+		if len(k) == 0 {
+			k = strings.ToLower(id.Type) + ":" + strings.ToLower(id.Value)
+		}
+		if !known[k] {
+			known[k] = true
+			w.ExternalIDs = append(w.ExternalIDs, id)
+		}
+	}
+}
+
+// dedupWorks merges duplicated works, which share an external
+// identifier or have similar titles and close publication years. Each
+// group of duplicates is merged into the work with the richest metadata
+// which takes the place of the first one of the group. The order of
+// other works is kept.
+func dedupWorks(works []*orcid.Work) ([]*orcid.Work, []dedupMerge) {
+	// duplicates are grouped with a union-find, so a preprint and
+	// a paper are merged even if only a third record links them
+	parent := make([]int, len(works))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	infos := make([]dedupInfo, len(works))
+	for i, w := range works {
+		infos[i] = newDedupInfo(w)
+	}
+
+	// a group never gets two different DOIs, even through a work
+	// without a DOI which is alike both of them
+	dois := make([]doi.DOI, len(works))
+	for i := range works {
+		dois[i] = infos[i].doi
+	}
+
+	// only works sharing an identifier or published in close years are
+	// compared, works without a year are compared with all others
+	byKey := map[string][]int{}
+	byYear := map[int][]int{}
+	for i, info := range infos {
+		for _, k := range info.keys {
+			byKey[k] = append(byKey[k], i)
+		}
+		byYear[info.year] = append(byYear[info.year], i)
+	}
+
+	reasons := make([]string, len(works))
+	for i := range works {
+		for _, j := range dedupCandidates(i, infos[i], byKey, byYear, len(works)) {
+			ri, rj := find(i), find(j)
+			if ri == rj || len(dois[ri]) > 0 && len(dois[rj]) > 0 && dois[ri] != dois[rj] {
+				continue
+			}
+			if reason := infos[i].duplicateReason(infos[j]); len(reason) > 0 {
+				parent[rj] = ri
+				if len(dois[ri]) == 0 {
+					dois[ri] = dois[rj]
+				}
+				reasons[j] = reason
+			}
+		}
+	}
+
+	groups := map[int][]int{}
+	order := []int{}
+	for i := range works {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			order = append(order, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+
+	unique := make([]*orcid.Work, 0, len(order))
+	merges := []dedupMerge{}
+	for _, root := range order {
+		group := groups[root]
+		if len(group) == 1 {
+			unique = append(unique, works[group[0]])
+			continue
+		}
+
+		best := group[0]
+		for _, i := range group[1:] {
+			if metadataRichness(works[i]) > metadataRichness(works[best]) {
+				best = i
+			}
+		}
+
+		merge := dedupMerge{Kept: works[best]}
+		for _, i := range group {
+			if i == best {
+				continue
+			}
+			mergeWork(works[best], works[i])
+			reason := reasons[i]
+			if len(reason) == 0 {
+				reason = reasons[best]
+			}
+			merge.Merged = append(merge.Merged, works[i])
+			merge.Reasons = append(merge.Reasons, reason)
+		}
+
+		unique = append(unique, works[best])
+		merges = append(merges, merge)
+	}
+
+	return unique, merges
+}
+
+// dedupCandidates returns indexes of works after the i-th one in
+// ascending order which might be its duplicates: works sharing an
+// identifier and works of close years.
+func dedupCandidates(i int, info dedupInfo, byKey map[string][]int, byYear map[int][]int, n int) []int {
+	if info.year == 0 {
+		all := make([]int, 0, n-i-1)
+		for j := i + 1; j < n; j++ {
+			all = append(all, j)
+		}
+		return all
+	}
+
+	seen := map[int]bool{}
+	candidates := []int{}
+	add := func(indexes []int) {
+		for _, j := range indexes {
+			if j > i && !seen[j] {
+				seen[j] = true
+				candidates = append(candidates, j)
+			}
+		}
+	}
+	for _, k := range info.keys {
+		add(byKey[k])
+	}
+	for y := info.year - dedupYearDistance; y <= info.year+dedupYearDistance; y++ {
+		add(byYear[y])
+	}
+	add(byYear[0])
+	sort.Ints(candidates)
+	return candidates
+}
+
+// aggregateWorks returns works of all users with duplicates merged
+// across users, e.g. copies of a co-authored paper in profiles of
+// several group members. Works are copied, so works of the users are
+// left as they are. Members of merged works list names of all users
+// who have the work.
+func aggregateWorks(users []*user, logger *log.Logger) []*orcid.Work {
+	works := []*orcid.Work{}
+	for _, u := range users {
+		member := u.name()
+		for _, w := range u.Works {
+			clone := *w
+			clone.ExternalIDs = append([]orcid.ExternalID(nil), w.ExternalIDs...)
+			clone.Preprints = append([]*orcid.Work(nil), w.Preprints...)
+			clone.Members = []string{member}
+			works = append(works, &clone)
+		}
+	}
+
+	works, merges := dedupWorks(works)
+	for _, m := range merges {
+		logger.Printf("duplicates of %s %s", strings.Join(m.Kept.Members, ", "), m)
+	}
+	return works
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the amount of unchanged lines shown around each
+// change in a unified diff.
+const diffContext = 3
+
+// diffOp is a single line of an edit script: ' ' keeps a line, '-'
+// removes a line from the old text and '+' adds a line from the new
+// one. aLine and bLine are zero-based positions in the old and the new
+// texts where the operation takes place.
+type diffOp struct {
+	kind  byte
+	aLine int
+	bLine int
+	text  string
+}
+
+// unifiedDiff returns the difference between two texts in the unified
+// format, it returns an empty string if the texts are equal.
+func unifiedDiff(fromName, toName, from, to string) string {
+	ops := diffLines(splitLines(from), splitLines(to))
+
+	var out strings.Builder
+	for start := 0; start < len(ops); {
+		// looking for the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// extending the hunk while changes are close to each other
+		end := start + 1
+		for k := end; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				end = k + 1
+				continue
+			}
+			if k-end >= 2*diffContext {
+				break
+			}
+		}
+
+		lo := start - diffContext
+		if lo < 0 {
+			lo = 0
+		}
+		hi := end + diffContext
+		if hi > len(ops) {
+			hi = len(ops)
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+
+		var aLen, bLen int
+		for _, op := range ops[lo:hi] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		aStart, bStart := ops[lo].aLine, ops[lo].bLine
+		if aLen > 0 {
+			aStart++
+		}
+		if bLen > 0 {
+			bStart++
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+		for _, op := range ops[lo:hi] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.text)
+		}
+
+		start = hi
+	}
+
+	return out.String()
+}
+
+// diffLines builds an edit script turning a into b using the longest
+// common subsequence of lines.
+func diffLines(a, b []string) []diffOp {
+	m, n := len(a), len(b)
+
+	lcs := make([][]int, m+1)
+	for i := range lcs {
+		lcs[i] = make([]int, n+1)
+	}
+	for i := m - 1; i >= 0; i-- {
+		for j := n - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := []diffOp{}
+	i, j := 0, 0
+	for i < m && j < n {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', i, j, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', i, j, a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', i, j, b[j]})
+			j++
+		}
+	}
+	for ; i < m; i++ {
+		ops = append(ops, diffOp{'-', i, j, a[i]})
+	}
+	for ; j < n; j++ {
+		ops = append(ops, diffOp{'+', i, j, b[j]})
+	}
+
+	return ops
+}
+
+func splitLines(s string) []string {
+	if len(s) == 0 {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
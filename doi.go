@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"bitbucket.org/iharsuvorau/ims-publications/cache"
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
+	"bitbucket.org/iharsuvorau/ims-publications/orcid"
+)
+
+// doiWork returns metadata of the ORCID work resolved by its DOI with
+// content negotiation or nil if the work has no DOI or it could not be
+// resolved.
+func doiWork(ctx context.Context, w *orcid.Work, resolver *doi.Client, c *cache.Cache, logger *log.Logger) *doi.Work {
+	id, err := w.DOI()
+	if err != nil {
+		return nil
+	}
+
+	work, err := getDOIWork(ctx, resolver, c, id, logger)
+	if err != nil {
+		logger.Printf("doi resolve error: %v", err)
+		return nil
+	}
+
+	return work
+}
+
+// getDOIWork returns DOI metadata from the cache if it's fresh,
+// otherwise the metadata is resolved and cached. DOIs which can't be
+// resolved are cached as null, so they aren't requested again until the
+// entry is obsolete, and doi.ErrNotFound is returned for them. The cache
+// is optional.
+func getDOIWork(ctx context.Context, resolver *doi.Client, c *cache.Cache, id doi.DOI, logger *log.Logger) (*doi.Work, error) {
+	key := doiCacheKey(id)
+
+	var work *doi.Work
+	ok, err := readCachedJSON(c, key, &work)
+	if err != nil {
+		logger.Printf("failed to read the cached DOI metadata %s: %v", id, err)
+	}
+	if ok {
+		if work == nil {
+			return nil, fmt.Errorf("DOI metadata %s: %w", id, doi.ErrNotFound)
+		}
+		return work, nil
+	}
+
+	logger.Printf("doi resolve: %s", id)
+	work, err = doi.GetWork(ctx, resolver, id)
+	if errors.Is(err, doi.ErrNotFound) {
+		if err := writeCachedJSON(c, key, nil); err != nil {
+			logger.Printf("failed to cache the missing DOI metadata %s: %v", id, err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = writeCachedJSON(c, key, work); err != nil {
+		logger.Printf("failed to cache the DOI metadata %s: %v", id, err)
+	}
+
+	return work, nil
+}
+
+func contributorsFromDOI(work *doi.Work) []*orcid.Contributor {
+	contribs := []*orcid.Contributor{}
+	for i, v := range work.Authors {
+		c := &orcid.Contributor{
+			Name:       v.FullName(),
+			GivenName:  v.Given,
+			FamilyName: v.Family,
+			Sequence:   "additional",
+			Role:       "author",
+		}
+		if i == 0 {
+			c.Sequence = "first"
+		}
+		if len(v.ORCID) > 0 {
+			if id, err := orcid.IDFromURL(v.ORCID); err == nil {
+				c.ORCID = id
+			}
+		}
+		contribs = append(contribs, c)
+	}
+	return contribs
+}
+
+// completeWithDOI fills the journal title, publication date and type of
+// the ORCID work from the DOI metadata if they are missing.
+func completeWithDOI(w *orcid.Work, work *doi.Work) {
+	completeWork(w, work.ContainerTitle, work.Issued.Year, work.Issued.Month, work.Issued.Day, cslTypes[work.Type])
+}
+
+// cslTypes maps CSL item types to ORCID work types, types without a
+// counterpart are left as they are in ORCID.
+var cslTypes = map[string]string{
+	"article-journal":  "journal-article",
+	"paper-conference": "conference-paper",
+	"book":             "book",
+	"chapter":          "book-chapter",
+	"thesis":           "dissertation",
+	"report":           "report",
+	"dataset":          "data-set",
+	"software":         "software",
+}
@@ -0,0 +1,97 @@
+package doi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nickng/bibtex"
+)
+
+// bibTeXTypes maps BibTeX entry types to CSL item types.
+var bibTeXTypes = map[string]string{
+	"article":       "article-journal",
+	"inproceedings": "paper-conference",
+	"conference":    "paper-conference",
+	"book":          "book",
+	"inbook":        "chapter",
+	"incollection":  "chapter",
+	"phdthesis":     "thesis",
+	"mastersthesis": "thesis",
+	"techreport":    "report",
+	"dataset":       "dataset",
+	"software":      "software",
+}
+
+// bibTeXMonths maps month macros to numbers.
+var bibTeXMonths = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+func decodeBibTeX(s string) (*Work, error) {
+	bib, err := bibtex.Parse(strings.NewReader(s))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode BibTeX: %v", err)
+	}
+	if len(bib.Entries) == 0 {
+		return nil, fmt.Errorf("failed to decode BibTeX: no entries")
+	}
+	entry := bib.Entries[0]
+
+	field := func(name string) string {
+		v, ok := entry.Fields[name]
+		if !ok || v == nil {
+			return ""
+		}
+		return strings.TrimSpace(strings.Trim(v.String(), "{}"))
+	}
+
+	work := Work{
+		DOI:            field("doi"),
+		Type:           bibTeXTypes[entry.Type],
+		Title:          field("title"),
+		ContainerTitle: field("journal"),
+		Publisher:      field("publisher"),
+		URL:            field("url"),
+	}
+	if len(work.ContainerTitle) == 0 {
+		work.ContainerTitle = field("booktitle")
+	}
+	if len(work.Type) == 0 {
+		work.Type = entry.Type
+	}
+
+	work.Issued.Year, _ = strconv.Atoi(field("year"))
+	month := strings.ToLower(field("month"))
+	if m, err := strconv.Atoi(month); err == nil {
+		work.Issued.Month = m
+	} else if len(month) >= 3 {
+		work.Issued.Month = bibTeXMonths[month[:3]]
+	}
+
+	for _, name := range strings.Split(field("author"), " and ") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		work.Authors = append(work.Authors, bibTeXAuthor(name))
+	}
+
+	return &work, nil
+}
+
+// bibTeXAuthor splits a name which is either "Family, Given" or
+// "Given Family", names in braces are kept as they are.
+func bibTeXAuthor(name string) Author {
+	if strings.HasPrefix(name, "{") && strings.HasSuffix(name, "}") {
+		return Author{Literal: strings.Trim(name, "{}")}
+	}
+	if i := strings.Index(name, ","); i >= 0 {
+		return Author{Given: strings.TrimSpace(name[i+1:]), Family: strings.TrimSpace(name[:i])}
+	}
+	if i := strings.LastIndex(name, " "); i >= 0 {
+		return Author{Given: name[:i], Family: name[i+1:]}
+	}
+	return Author{Family: name}
+}
@@ -0,0 +1,104 @@
+package doi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// cslItem is a CSL-JSON item. Registration agencies differ in details,
+// e.g. titles might be strings or arrays and date parts might be
+// numbers or strings, so such fields are decoded leniently.
+type cslItem struct {
+	DOI            string      `json:"DOI"`
+	Type           string      `json:"type"`
+	Title          cslText     `json:"title"`
+	ContainerTitle cslText     `json:"container-title"`
+	Publisher      string      `json:"publisher"`
+	URL            string      `json:"URL"`
+	Issued         cslDate     `json:"issued"`
+	Author         []cslAuthor `json:"author"`
+}
+
+type cslAuthor struct {
+	Given   string `json:"given"`
+	Family  string `json:"family"`
+	Literal string `json:"literal"`
+	ORCID   string `json:"ORCID"`
+}
+
+// cslText is a string or an array of strings which are joined.
+type cslText string
+
+func (t *cslText) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = cslText(s)
+		return nil
+	}
+	var arr []string
+	if err := json.Unmarshal(data, &arr); err != nil {
+		return fmt.Errorf("text is neither a string nor an array of strings: %s", data)
+	}
+	*t = cslText(strings.Join(arr, " "))
+	return nil
+}
+
+// cslDate is a date like {"date-parts": [[2018, 3, 1]]}, where parts
+// might be strings and the month and day are optional.
+type cslDate struct {
+	DateParts [][]interface{} `json:"date-parts"`
+}
+
+func (d cslDate) date() Date {
+	if len(d.DateParts) == 0 {
+		return Date{}
+	}
+
+	var values [3]int
+	for i, v := range d.DateParts[0] {
+		if i >= len(values) {
+			break
+		}
+		switch p := v.(type) {
+		case float64:
+			values[i] = int(p)
+		case string:
+			values[i], _ = strconv.Atoi(p)
+		}
+	}
+
+	return Date{Year: values[0], Month: values[1], Day: values[2]}
+}
+
+func decodeCSL(r io.Reader) (*Work, error) {
+	item := cslItem{}
+	if err := json.NewDecoder(r).Decode(&item); err != nil {
+		return nil, fmt.Errorf("failed to decode CSL-JSON: %v", err)
+	}
+
+	work := Work{
+		DOI:            item.DOI,
+		Type:           item.Type,
+		Title:          string(item.Title),
+		ContainerTitle: string(item.ContainerTitle),
+		Publisher:      item.Publisher,
+		URL:            item.URL,
+		Issued:         item.Issued.date(),
+	}
+	for _, a := range item.Author {
+		if len(a.Literal) == 0 && len(a.Family) == 0 && len(a.Given) == 0 {
+			continue
+		}
+		work.Authors = append(work.Authors, Author{
+			Given:   a.Given,
+			Family:  a.Family,
+			Literal: a.Literal,
+			ORCID:   a.ORCID,
+		})
+	}
+
+	return &work, nil
+}
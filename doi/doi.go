@@ -0,0 +1,333 @@
+// Package doi resolves DOIs of any registration agency, e.g. CrossRef,
+// DataCite or mEDRA, into metadata using content negotiation of the
+// doi.org resolver, read more at https://citation.crosscite.org/docs.html.
+package doi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"bitbucket.org/iharsuvorau/ims-publications/internal/throttle"
+)
+
+// Media types supported by content negotiation of all registration
+// agencies.
+const (
+	CSLJSON = "application/vnd.citationstyles.csl+json"
+	BibTeX  = "application/x-bibtex"
+)
+
+// DOI is a Digital Object Identifier, e.g. 10.3390/act7010007. DOIs are
+// case-insensitive, Parse returns them in the canonical lower-case form,
+// so equal DOIs can be compared as strings.
+type DOI string
+
+func (id DOI) String() string {
+	return string(id)
+}
+
+// URL returns the https://doi.org link of the DOI.
+func (id DOI) URL() string {
+	u := url.URL{Scheme: "https", Host: "doi.org", Path: "/" + string(id)}
+	return u.String()
+}
+
+// Valid checks the syntax of the DOI, read more at
+// https://www.doi.org/doi_handbook/2_Numbering.html#2.2.
+func (id DOI) Valid() bool {
+	return doiSyntax.MatchString(string(id))
+}
+
+// doiSyntax is the prefix of a directory indicator 10 and a registrant
+// code, and a non-empty suffix without spaces and quotes.
+var doiSyntax = regexp.MustCompile(`^10\.[0-9]+(\.[0-9]+)*/[^\s"]+$`)
+
+// doiHosts are resolvers which have a DOI as the path of their links.
+var doiHosts = map[string]bool{
+	"doi.org":        true,
+	"dx.doi.org":     true,
+	"www.doi.org":    true,
+	"hdl.handle.net": true,
+}
+
+// Parse returns the canonical DOI of a DOI string like 10.1000/ABC,
+// doi:10.1000/abc or https://doi.org/10.1000/abc. Links of other sites
+// are accepted too if the DOI is in their path, e.g.
+// https://link.springer.com/article/10.1007/s10846-018-0833-y.
+// Percent-encoded DOIs are decoded.
+func Parse(s string) (DOI, error) {
+	// ORCID keeps some links HTML-escaped
+	v := strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(strings.TrimSpace(s))
+
+	lower := strings.ToLower(v)
+	switch {
+	case strings.HasPrefix(lower, "doi:"):
+		v = strings.TrimSpace(v[len("doi:"):])
+		if unescaped, err := url.PathUnescape(v); err == nil {
+			v = unescaped
+		}
+	case strings.Contains(lower, "://") || strings.HasPrefix(lower, "doi.org/") || strings.HasPrefix(lower, "dx.doi.org/"):
+		if !strings.Contains(lower, "://") {
+			v = "https://" + v
+		}
+		u, err := url.Parse(v)
+		if err != nil {
+			return "", fmt.Errorf("no DOI found in %s: %v", s, err)
+		}
+		v = strings.TrimPrefix(u.Path, "/")
+		if !doiHosts[strings.ToLower(u.Hostname())] {
+			// the DOI is somewhere in the path of a publisher link
+			i := strings.Index(v, "10.")
+			for i > 0 && v[i-1] != '/' {
+				next := strings.Index(v[i+1:], "10.")
+				if next < 0 {
+					i = -1
+					break
+				}
+				i += next + 1
+			}
+			if i < 0 {
+				return "", fmt.Errorf("no DOI found in %s", s)
+			}
+			v = v[i:]
+		}
+	default:
+		if unescaped, err := url.PathUnescape(v); err == nil {
+			v = unescaped
+		}
+	}
+
+	v = trimTrailing(v)
+
+	id := DOI(strings.ToLower(v))
+	if !id.Valid() {
+		return "", fmt.Errorf("no DOI found in %s", s)
+	}
+	return id, nil
+}
+
+// closingBrackets map closing brackets to opening ones.
+var closingBrackets = map[byte]byte{')': '(', ']': '[', '}': '{', '>': '<'}
+
+// trimTrailing trims slashes and punctuation left by links and
+// sentences, e.g. of (see 10.1000/abc). or <10.1000/abc>. Closing
+// brackets are trimmed only if they aren't opened in the DOI, so
+// 10.1016/s0140-6736(20) is kept as it is.
+func trimTrailing(v string) string {
+	for {
+		v = strings.TrimRight(v, "/.,;")
+		if len(v) == 0 {
+			return v
+		}
+		last := v[len(v)-1]
+		open, ok := closingBrackets[last]
+		if !ok || strings.Count(v, string(open)) >= strings.Count(v, string(last)) {
+			return v
+		}
+		v = v[:len(v)-1]
+	}
+}
+
+// ErrNotFound is returned for a DOI which isn't registered or has no
+// metadata in the requested media type.
+var ErrNotFound = errors.New("not found")
+
+// Client resolves DOIs with content negotiation.
+type Client struct {
+	resolver   *url.URL
+	backoff    throttle.Backoff
+	httpClient *http.Client
+}
+
+// Option configures a client.
+type Option func(*Client)
+
+// WithRetries sets the amount of retries of a request failed because of
+// a network error, the 429 or 5xx status. Three retries are made by
+// default.
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		c.backoff.Retries = n
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for all requests, e.g. to
+// configure timeouts, a proxy or a transport. http.DefaultClient is used
+// by default.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		if hc != nil {
+			c.httpClient = hc
+		}
+	}
+}
+
+// New returns a client of the resolver, e.g. https://doi.org.
+func New(resolver string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(resolver, "/") + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		resolver:   u,
+		backoff:    throttle.Backoff{Retries: 3, Min: time.Second, Max: time.Second * 30},
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// Resolver returns the resolver URL.
+func (c *Client) Resolver() *url.URL {
+	return c.resolver
+}
+
+// get requests the DOI in the media type retrying transient failures
+// until the context is done. The resolver redirects to the registration
+// agency which keeps the Accept header. The caller must close the body
+// of the response.
+func (c *Client) get(ctx context.Context, id DOI, mediaType string) (*http.Response, error) {
+	uri := c.resolver.String() + url.PathEscape(string(id))
+	// slashes are the part of DOIs, which are not escaped by doi.org
+	uri = strings.ReplaceAll(uri, "%2F", "/")
+
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaType)
+
+	var resp *http.Response
+	for retry := 0; ; retry++ {
+		resp, err = c.httpClient.Do(req)
+		if err == nil && !throttle.Retryable(resp.StatusCode) || retry >= c.backoff.Retries {
+			break
+		}
+
+		delay := c.backoff.Delay(retry)
+		if err == nil {
+			if d, ok := throttle.RetryAfter(resp.Header); ok {
+				delay = d
+			}
+			resp.Body.Close()
+		}
+		if err = throttle.Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %v", uri, err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusNotAcceptable {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to get %s as %s: %v: %w", uri, mediaType, resp.Status, ErrNotFound)
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to get %s as %s: %v", uri, mediaType, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// Work is metadata of a work registered with a DOI.
+type Work struct {
+	DOI string
+	// Type is a CSL item type, e.g. article-journal, paper-conference
+	// or dataset. BibTeX entry types are converted to CSL ones.
+	Type           string
+	Title          string
+	ContainerTitle string
+	Publisher      string
+	Issued         Date
+	Authors        []Author
+	URL            string
+}
+
+// Author is a creator of a work.
+type Author struct {
+	Given  string
+	Family string
+	// Literal is used for organizations or names which can't be split.
+	Literal string
+	// ORCID is the ORCID iD URL if the agency provides it.
+	ORCID string
+}
+
+// FullName returns the literal name or the given and family names.
+func (a Author) FullName() string {
+	if len(a.Literal) > 0 {
+		return a.Literal
+	}
+	return strings.TrimSpace(a.Given + " " + a.Family)
+}
+
+// Date is a partial date, the month and day might be unknown.
+type Date struct {
+	Year  int
+	Month int
+	Day   int
+}
+
+// IsZero checks if the date is unknown.
+func (d Date) IsZero() bool {
+	return d.Year == 0
+}
+
+// GetWork returns metadata of the DOI. CSL-JSON is requested first,
+// BibTeX is used if CSL-JSON is not available.
+func GetWork(ctx context.Context, c *Client, id DOI) (*Work, error) {
+	work, err := GetCSL(ctx, c, id)
+	if err == nil {
+		return work, nil
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+
+	work, bibErr := GetBibTeX(ctx, c, id)
+	if bibErr != nil && errors.Is(err, ErrNotFound) && errors.Is(bibErr, ErrNotFound) {
+		return nil, fmt.Errorf("CSL-JSON: %v; BibTeX: %w", err, bibErr)
+	}
+	if bibErr != nil {
+		return nil, fmt.Errorf("CSL-JSON: %v; BibTeX: %v", err, bibErr)
+	}
+	return work, nil
+}
+
+// GetCSL returns metadata of the DOI requested as CSL-JSON.
+func GetCSL(ctx context.Context, c *Client, id DOI) (*Work, error) {
+	resp, err := c.get(ctx, id, CSLJSON)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return decodeCSL(resp.Body)
+}
+
+// GetBibTeX returns metadata of the DOI requested as BibTeX.
+func GetBibTeX(ctx context.Context, c *Client, id DOI) (*Work, error) {
+	resp, err := c.get(ctx, id, BibTeX)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBibTeX(string(data))
+}
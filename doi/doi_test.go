@@ -0,0 +1,292 @@
+package doi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testCSL = `{
+  "type": "dataset",
+  "DOI": "10.5281/zenodo.1234",
+  "title": "Measurements of Soft Actuators",
+  "container-title": ["Zenodo"],
+  "publisher": "Zenodo",
+  "URL": "https://zenodo.org/record/1234",
+  "issued": {"date-parts": [["2019", "5"]]},
+  "author": [
+    {"given": "Jane", "family": "Doe", "ORCID": "https://orcid.org/0000-0002-0183-1282"},
+    {"literal": "Soft Robotics Lab"}
+  ]
+}`
+
+const testBibTeX = `@inproceedings{Doe_2019,
+	doi = {10.1000/conf.2019},
+	url = {https://doi.org/10.1000/conf.2019},
+	year = 2019,
+	month = {may},
+	publisher = {{IEEE}},
+	author = {Jane Doe and Roe, John},
+	title = {Soft Actuators},
+	booktitle = {Proceedings of the Conference}
+}`
+
+func Test_decodeCSL(t *testing.T) {
+	got, err := decodeCSL(strings.NewReader(testCSL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Work{
+		DOI:            "10.5281/zenodo.1234",
+		Type:           "dataset",
+		Title:          "Measurements of Soft Actuators",
+		ContainerTitle: "Zenodo",
+		Publisher:      "Zenodo",
+		URL:            "https://zenodo.org/record/1234",
+		Issued:         Date{Year: 2019, Month: 5},
+		Authors: []Author{
+			{Given: "Jane", Family: "Doe", ORCID: "https://orcid.org/0000-0002-0183-1282"},
+			{Literal: "Soft Robotics Lab"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeCSL() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_decodeBibTeX(t *testing.T) {
+	got, err := decodeBibTeX(testBibTeX)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Work{
+		DOI:            "10.1000/conf.2019",
+		Type:           "paper-conference",
+		Title:          "Soft Actuators",
+		ContainerTitle: "Proceedings of the Conference",
+		Publisher:      "IEEE",
+		URL:            "https://doi.org/10.1000/conf.2019",
+		Issued:         Date{Year: 2019, Month: 5},
+		Authors: []Author{
+			{Given: "Jane", Family: "Doe"},
+			{Given: "John", Family: "Roe"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeBibTeX() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	type args struct {
+		s string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    DOI
+		wantErr bool
+	}{
+		{
+			name:    "A",
+			args:    args{s: "https://doi.org/10.3390/act7010007"},
+			want:    DOI("10.3390/act7010007"),
+			wantErr: false,
+		},
+		{
+			name:    "B",
+			args:    args{s: "https://doi.org/10.3390/act7010007/"},
+			want:    DOI("10.3390/act7010007"),
+			wantErr: false,
+		},
+		{
+			name:    "C",
+			args:    args{s: "doi.org/10.3390/act7010007/"},
+			want:    DOI("10.3390/act7010007"),
+			wantErr: false,
+		},
+		{
+			name:    "D",
+			args:    args{s: "10.1000/123456"},
+			want:    DOI("10.1000/123456"),
+			wantErr: false,
+		},
+		{
+			name:    "E",
+			args:    args{s: "10.1038/issn.1476-4687"},
+			want:    DOI("10.1038/issn.1476-4687"),
+			wantErr: false,
+		},
+		{
+			name:    "F",
+			args:    args{s: "978-12345-99990"},
+			want:    DOI(""),
+			wantErr: true,
+		},
+		{
+			name:    "G",
+			args:    args{s: "10.978.86123/45678"},
+			want:    DOI("10.978.86123/45678"),
+			wantErr: false,
+		},
+		{
+			name:    "H",
+			args:    args{s: "doi:10.1109/JSEN.2018.2797526"},
+			want:    DOI("10.1109/jsen.2018.2797526"),
+			wantErr: false,
+		},
+		{
+			name:    "I",
+			args:    args{s: "http://dx.doi.org/10.1002%2F%28SICI%291097-4636"},
+			want:    DOI("10.1002/(sici)1097-4636"),
+			wantErr: false,
+		},
+		{
+			name:    "J",
+			args:    args{s: "https://link.springer.com/article/10.1007/s10846-018-0833-y."},
+			want:    DOI("10.1007/s10846-018-0833-y"),
+			wantErr: false,
+		},
+		{
+			name:    "K",
+			args:    args{s: "10.1000/abc%20def"},
+			want:    DOI(""),
+			wantErr: true,
+		},
+		{
+			name:    "L",
+			args:    args{s: "https://example.com/110.1000/abc"},
+			want:    DOI(""),
+			wantErr: true,
+		},
+		{
+			name:    "M",
+			args:    args{s: "10.1/x)"},
+			want:    DOI("10.1/x"),
+			wantErr: false,
+		},
+		{
+			name:    "N",
+			args:    args{s: "10.1/x>"},
+			want:    DOI("10.1/x"),
+			wantErr: false,
+		},
+		{
+			name:    "O",
+			args:    args{s: "10.1000/abc])."},
+			want:    DOI("10.1000/abc"),
+			wantErr: false,
+		},
+		{
+			name:    "P",
+			args:    args{s: "https://doi.org/10.1000/abc}"},
+			want:    DOI("10.1000/abc"),
+			wantErr: false,
+		},
+		{
+			name:    "Q",
+			args:    args{s: "10.1016/S0140-6736(20)"},
+			want:    DOI("10.1016/s0140-6736(20)"),
+			wantErr: false,
+		},
+		{
+			name:    "R",
+			args:    args{s: "10.1002/(SICI)1097-4636(199706)35:4<465::AID-JBM6>3.0.CO;2-7>"},
+			want:    DOI("10.1002/(sici)1097-4636(199706)35:4<465::aid-jbm6>3.0.co;2-7"),
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.args.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDOI_URL(t *testing.T) {
+	tests := []struct {
+		name string
+		id   DOI
+		want string
+	}{
+		{name: "A", id: "10.3390/act7010007", want: "https://doi.org/10.3390/act7010007"},
+		{name: "B", id: "10.1002/(sici)1097-4636(199706)35:4<465::aid-jbm6>3.0.co;2-7", want: "https://doi.org/10.1002/%28sici%291097-4636%28199706%2935:4%3C465::aid-jbm6%3E3.0.co;2-7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.id.URL(); got != tt.want {
+				t.Errorf("URL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetWork(t *testing.T) {
+	var accepts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept := r.Header.Get("Accept")
+		accepts = append(accepts, r.URL.Path+" "+accept)
+
+		switch {
+		case r.URL.Path == "/10.5281/zenodo.1234" && accept == CSLJSON:
+			fmt.Fprint(w, testCSL)
+		case r.URL.Path == "/10.1000/conf.2019" && accept == BibTeX:
+			fmt.Fprint(w, testBibTeX)
+		case r.URL.Path == "/10.1000/conf.2019":
+			w.WriteHeader(http.StatusNotAcceptable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, WithRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	work, err := GetWork(context.Background(), c, DOI("10.5281/zenodo.1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if work.Type != "dataset" || len(work.Authors) != 2 {
+		t.Errorf("unexpected work: %+v", work)
+	}
+
+	work, err = GetWork(context.Background(), c, DOI("10.1000/conf.2019"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if work.Type != "paper-conference" || work.ContainerTitle != "Proceedings of the Conference" {
+		t.Errorf("unexpected work: %+v", work)
+	}
+
+	if _, err = GetWork(context.Background(), c, DOI("10.1000/missing")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want ErrNotFound for the missing DOI, got %v", err)
+	}
+
+	want := []string{
+		"/10.5281/zenodo.1234 " + CSLJSON,
+		"/10.1000/conf.2019 " + CSLJSON,
+		"/10.1000/conf.2019 " + BibTeX,
+		"/10.1000/missing " + CSLJSON,
+		"/10.1000/missing " + BibTeX,
+	}
+	if !reflect.DeepEqual(accepts, want) {
+		t.Errorf("unexpected requests: %v", accepts)
+	}
+}
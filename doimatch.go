@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"bitbucket.org/iharsuvorau/ims-publications/cache"
+	"bitbucket.org/iharsuvorau/ims-publications/crossref"
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
+	"bitbucket.org/iharsuvorau/ims-publications/orcid"
+)
+
+// doiSearchRows is the amount of CrossRef candidates considered for a
+// work.
+const doiSearchRows = 5
+
+// doiMatch is a CrossRef work proposed as the source of a DOI for an
+// ORCID work.
+type doiMatch struct {
+	Work       *crossref.Work
+	DOI        doi.DOI
+	Confidence float64
+}
+
+// recoverDOIs searches CrossRef for works of the users which have no
+// DOI. The DOI of the best candidate is applied if its confidence is at
+// least the threshold, otherwise candidates are logged for a manual
+// review.
+func recoverDOIs(ctx context.Context, cref *crossref.Client, c *cache.Cache, users []*user, threshold float64, logger *log.Logger) error {
+	for _, u := range users {
+		owner := u.name()
+
+		for _, w := range u.Works {
+			if _, err := w.DOI(); err == nil || len(w.Title) == 0 {
+				continue
+			}
+
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("DOI search is interrupted: %v", err)
+			}
+
+			matches, err := searchDOI(ctx, cref, c, w, owner, logger)
+			if err != nil {
+				logger.Printf("crossref search error for %q: %v", w.Title, err)
+				continue
+			}
+			if len(matches) == 0 {
+				logger.Printf("no DOI candidates for %q", w.Title)
+				continue
+			}
+
+			best := matches[0]
+			if best.Confidence >= threshold {
+				logger.Printf("DOI %s is applied to %q with confidence %.2f", best.DOI, w.Title, best.Confidence)
+				applyDOI(w, best.DOI)
+				continue
+			}
+
+			candidates := make([]string, len(matches))
+			for i, m := range matches {
+				candidates[i] = fmt.Sprintf("%s %q (%.2f)", m.DOI, m.Work.Title, m.Confidence)
+			}
+			logger.Printf("no confident DOI match for %q of %s, candidates: %s",
+				w.Title, owner, strings.Join(candidates, ", "))
+		}
+	}
+
+	return nil
+}
+
+// searchDOI returns CrossRef candidates for the work of the owner
+// sorted by confidence in descending order. Search results are cached.
+func searchDOI(ctx context.Context, cref *crossref.Client, c *cache.Cache, w *orcid.Work, owner string, logger *log.Logger) ([]doiMatch, error) {
+	title := plainTitle(string(w.Title))
+	q := crossref.Query{Bibliographic: title, Author: owner, Rows: doiSearchRows}
+	if w.Year > 0 {
+		q.Bibliographic = fmt.Sprintf("%s %d", title, w.Year)
+	}
+
+	key := crossrefSearchCacheKey(q)
+	var works []*crossref.Work
+	ok, err := readCachedJSON(c, key, &works)
+	if err != nil {
+		logger.Printf("failed to read the cached crossref search for %q: %v", title, err)
+	}
+	if !ok {
+		logger.Printf("crossref search: %q", title)
+		works, err = crossref.SearchWorks(ctx, cref, q)
+		if err != nil {
+			return nil, err
+		}
+		if err = writeCachedJSON(c, key, works); err != nil {
+			logger.Printf("failed to cache the crossref search for %q: %v", title, err)
+		}
+	}
+
+	matches := make([]doiMatch, 0, len(works))
+	for _, cw := range works {
+		id, err := doi.Parse(cw.DOI)
+		if err != nil {
+			continue
+		}
+		matches = append(matches, doiMatch{Work: cw, DOI: id, Confidence: matchConfidence(w, owner, cw)})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Confidence > matches[j].Confidence
+	})
+
+	return matches, nil
+}
+
+// matchConfidence estimates how likely the CrossRef work is the ORCID
+// work of the owner, from 0 to 1. The title similarity weighs the most,
+// the publication year and the owner among the authors confirm it.
+func matchConfidence(w *orcid.Work, owner string, cw *crossref.Work) float64 {
+	const (
+		titleWeight  = 0.6
+		yearWeight   = 0.2
+		authorWeight = 0.2
+	)
+
+	confidence := titleWeight * titleSimilarity(string(w.Title), cw.Title)
+
+	year := cw.Issued.Year
+	if year == 0 {
+		year = cw.Published.Year
+	}
+	switch {
+	case w.Year == 0 || year == 0:
+		confidence += yearWeight / 2
+	case w.Year == year:
+		confidence += yearWeight
+	case w.Year-year == 1 || year-w.Year == 1:
+		// online and print publications are often a year apart
+		confidence += yearWeight / 2
+	}
+
+	fields := strings.Fields(owner)
+	switch {
+	case len(cw.Authors) == 0 || len(fields) == 0:
+		confidence += authorWeight / 2
+	default:
+		family := strings.ToLower(fields[len(fields)-1])
+		for _, a := range cw.Authors {
+			if strings.Contains(strings.ToLower(a.FullName()), family) {
+				confidence += authorWeight
+				break
+			}
+		}
+	}
+
+	return confidence
+}
+
+// titleMarkup matches the markup added to titles by orcid.UpdateMarkup
+// and HTML tags.
+var titleMarkup = regexp.MustCompile(`</?[a-zA-Z]+>|\{\{(sub|sup)\||\}\}`)
+
+// plainTitle removes markup from the title.
+func plainTitle(s string) string {
+	return strings.Join(strings.Fields(titleMarkup.ReplaceAllString(s, "")), " ")
+}
+
+// titleWords returns the set of lower-case words of the title without
+// punctuation and markup.
+func titleWords(s string) map[string]bool {
+	s = strings.ToLower(plainTitle(s))
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+// titleSimilarity is the Dice coefficient of the title words, 1 means
+// the same words.
+func titleSimilarity(a, b string) float64 {
+	return wordsSimilarity(titleWords(a), titleWords(b))
+}
+
+// wordsSimilarity is the Dice coefficient of the word sets.
+func wordsSimilarity(wa, wb map[string]bool) float64 {
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	common := 0
+	for w := range wa {
+		if wb[w] {
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(wa)+len(wb))
+}
+
+// applyDOI adds the DOI as an external identifier of the work.
+func applyDOI(w *orcid.Work, id doi.DOI) {
+	uri := template.HTML(id.URL())
+	w.ExternalIDs = append(w.ExternalIDs, orcid.ExternalID{
+		Type:  "doi",
+		Value: id.String(),
+		URL:   uri,
+	})
+	w.DoiURI = uri
+}
@@ -1,9 +1,10 @@
 module bitbucket.org/iharsuvorau/ims-publications
 
-go 1.13
+go 1.16
 
 require (
 	bitbucket.org/iharsuvorau/mediawiki v1.0.0
 	github.com/nickng/bibtex v1.0.1
 	github.com/pkg/errors v0.8.1
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"bitbucket.org/iharsuvorau/ims-publications/orcid"
+)
+
+// workGroup is a titled group of works passed to templates. Groups are
+// ordered as they are shown on a page. Works of a group are ordered too,
+// a group might have subgroups instead of works, e.g. a section of works
+// of some types has a subgroup for each year.
+type workGroup struct {
+	Title     string
+	Works     []*orcid.Work
+	Subgroups []*workGroup
+}
+
+// grouper groups works of a page. Works of types which are hidden by the
+// taxonomy are not listed by any grouper.
+type grouper interface {
+	Group(works []*orcid.Work) []*workGroup
+}
+
+// grouperFunc is a grouper of a function.
+type grouperFunc func(works []*orcid.Work) []*workGroup
+
+func (f grouperFunc) Group(works []*orcid.Work) []*workGroup {
+	return f(works)
+}
+
+// groupings are names of built-in groupers:
+//
+//	type-year  sections of the taxonomy, each with a subgroup per year
+//	year-type  years, each with a subgroup per section of the taxonomy
+//	type       sections of the taxonomy, works are sorted by year
+//	year       years
+//	venue      journal titles and other works in the end
+//	pi         PIs of the aggregate page, co-authored works are listed
+//	           under each PI, works without PIs are in the end
+//	flat       a single untitled group of works sorted by year
+var groupings = []string{"type-year", "year-type", "type", "year", "venue", "pi", "flat"}
+
+// newGrouper returns the built-in grouper of the name.
+func newGrouper(name string, tax taxonomy, logger *log.Logger) (grouper, error) {
+	var f grouperFunc
+	switch name {
+	case "type-year":
+		f = func(works []*orcid.Work) []*workGroup {
+			return groupByTypeAndYear(works, tax, logger)
+		}
+	case "year-type":
+		f = func(works []*orcid.Work) []*workGroup {
+			return groupByYearAndType(works, tax, logger)
+		}
+	case "type":
+		f = func(works []*orcid.Work) []*workGroup {
+			groups := groupByType(works, tax)
+			for _, g := range groups {
+				g.Works = newestFirst(g.Works, logger)
+			}
+			return groups
+		}
+	case "year":
+		f = func(works []*orcid.Work) []*workGroup {
+			return groupByYear(tax.shown(works), logger)
+		}
+	case "venue":
+		f = func(works []*orcid.Work) []*workGroup {
+			return groupByVenue(tax.shown(works), logger)
+		}
+	case "pi":
+		f = func(works []*orcid.Work) []*workGroup {
+			return groupByMember(tax.shown(works), logger)
+		}
+	case "flat":
+		f = func(works []*orcid.Work) []*workGroup {
+			return []*workGroup{{Works: newestFirst(tax.shown(works), logger)}}
+		}
+	default:
+		return nil, fmt.Errorf("unknown grouping %q, expected one of: %s", name, strings.Join(groupings, ", "))
+	}
+	return f, nil
+}
+
+// groupByType groups works into shown sections of the taxonomy in its
+// order, sections without works are kept.
+func groupByType(works []*orcid.Work, tax taxonomy) []*workGroup {
+	byType := make([]*workGroup, len(tax))
+	for i, s := range tax {
+		byType[i] = &workGroup{Title: s.Title}
+	}
+	for _, w := range works {
+		if i := tax.sectionOf(w.Type); i >= 0 {
+			byType[i].Works = append(byType[i].Works, w)
+		}
+	}
+
+	groups := []*workGroup{}
+	for i, g := range byType {
+		if !tax[i].Hidden {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// groupByYear groups works by years in descending order, works with the
+// same DOI are listed once in a year.
+func groupByYear(works []*orcid.Work, logger *log.Logger) []*workGroup {
+	years := getYearsSorted(works)
+	groups := make([]*workGroup, len(years))
+	for i, year := range years {
+		groups[i] = &workGroup{Title: strconv.Itoa(year), Works: []*orcid.Work{}}
+		for _, w := range works {
+			if w.Year == year {
+				groups[i].Works = append(groups[i].Works, w)
+			}
+		}
+
+		// removing duplicates
+		unique, err := filterDuplicatedWorksByDOI(groups[i].Works, logger)
+		if err != nil {
+			logger.Println(err)
+			continue
+		}
+		groups[i].Works = unique
+	}
+	return groups
+}
+
+// groupByTypeAndYear groups works into shown sections of the taxonomy
+// in its order and works of each section by years.
+func groupByTypeAndYear(works []*orcid.Work, tax taxonomy, logger *log.Logger) []*workGroup {
+	groups := groupByType(works, tax)
+	for _, g := range groups {
+		g.Subgroups = groupByYear(g.Works, logger)
+		g.Works = nil
+	}
+	return groups
+}
+
+// groupByYearAndType groups works by years and works of each year into
+// sections of the taxonomy, sections without works are skipped.
+func groupByYearAndType(works []*orcid.Work, tax taxonomy, logger *log.Logger) []*workGroup {
+	groups := groupByYear(tax.shown(works), logger)
+	for _, g := range groups {
+		for _, sg := range groupByType(g.Works, tax) {
+			if len(sg.Works) > 0 {
+				g.Subgroups = append(g.Subgroups, sg)
+			}
+		}
+		g.Works = nil
+	}
+	return groups
+}
+
+// groupByVenue groups works by journal titles in alphabetical order,
+// works without a journal title are in the last group.
+func groupByVenue(works []*orcid.Work, logger *log.Logger) []*workGroup {
+	byVenue := map[string][]*orcid.Work{}
+	venues := []string{}
+	var other []*orcid.Work
+	for _, w := range works {
+		venue := strings.TrimSpace(w.JournalTitle)
+		if len(venue) == 0 {
+			other = append(other, w)
+			continue
+		}
+		// the same journal is often spelled in different cases
+		key := strings.ToLower(venue)
+		if _, ok := byVenue[key]; !ok {
+			venues = append(venues, venue)
+		}
+		byVenue[key] = append(byVenue[key], w)
+	}
+
+	sort.SliceStable(venues, func(i, j int) bool {
+		return strings.ToLower(venues[i]) < strings.ToLower(venues[j])
+	})
+
+	groups := make([]*workGroup, 0, len(venues)+1)
+	for _, venue := range venues {
+		groups = append(groups, &workGroup{Title: venue, Works: newestFirst(byVenue[strings.ToLower(venue)], logger)})
+	}
+	if len(other) > 0 {
+		groups = append(groups, &workGroup{Title: "Other", Works: newestFirst(other, logger)})
+	}
+	return groups
+}
+
+// groupByMember groups works by names of members who have them in
+// alphabetical order, works without members are in the last untitled
+// group. Members are set only for the aggregate page, so works of a
+// profile page end up in a single group.
+func groupByMember(works []*orcid.Work, logger *log.Logger) []*workGroup {
+	byMember := map[string][]*orcid.Work{}
+	var other []*orcid.Work
+	for _, w := range works {
+		if len(w.Members) == 0 {
+			other = append(other, w)
+			continue
+		}
+		for _, m := range w.Members {
+			byMember[m] = append(byMember[m], w)
+		}
+	}
+
+	members := make([]string, 0, len(byMember))
+	for m := range byMember {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+
+	groups := make([]*workGroup, 0, len(members)+1)
+	for _, m := range members {
+		groups = append(groups, &workGroup{Title: m, Works: newestFirst(byMember[m], logger)})
+	}
+	if len(other) > 0 {
+		groups = append(groups, &workGroup{Works: newestFirst(other, logger)})
+	}
+	return groups
+}
+
+// newestFirst returns works sorted by years in descending order, works
+// of a year are kept in their order.
+func newestFirst(works []*orcid.Work, logger *log.Logger) []*orcid.Work {
+	sorted := []*orcid.Work{}
+	for _, g := range groupByYear(works, logger) {
+		sorted = append(sorted, g.Works...)
+	}
+	return sorted
+}
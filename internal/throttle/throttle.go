@@ -0,0 +1,146 @@
+// Package throttle limits the rate of HTTP requests and decides when
+// and how long to wait before retrying failed ones.
+package throttle
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limiter spaces events evenly in time. It's safe for concurrent use,
+// so one limiter can be shared by all goroutines of a client.
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewLimiter returns a limiter allowing rps events per second. A
+// non-positive rate means no limit.
+func NewLimiter(rps float64) *Limiter {
+	l := &Limiter{}
+	if rps > 0 {
+		l.interval = time.Duration(float64(time.Second) / rps)
+	}
+	return l
+}
+
+// SetRate changes the rate to limit events per interval. A
+// non-positive limit or interval removes the limit.
+func (l *Limiter) SetRate(limit int, interval time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit <= 0 || interval <= 0 {
+		l.interval = 0
+		return
+	}
+	l.interval = interval / time.Duration(limit)
+}
+
+// Interval returns the minimal time between events.
+func (l *Limiter) Interval() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.interval
+}
+
+// Wait blocks until the next event is allowed or the context is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	return Sleep(ctx, l.reserve())
+}
+
+// reserve books the next slot and returns the time to wait for it.
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.interval == 0 {
+		return 0
+	}
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	return wait
+}
+
+// Sleep pauses for the duration or until the context is done, in the
+// latter case the error of the context is returned.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Backoff describes retries with exponentially growing delays.
+type Backoff struct {
+	// Retries is the maximum amount of retries after the first attempt.
+	Retries int
+	// Min is the delay before the first retry.
+	Min time.Duration
+	// Max caps delays.
+	Max time.Duration
+}
+
+// Delay returns the delay before the retry with the number starting
+// from 0. A random jitter of up to a half of the delay is added to
+// spread retries of concurrent requests.
+func (b Backoff) Delay(retry int) time.Duration {
+	d := b.Min
+	for i := 0; i < retry && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// Retryable checks if a request with the response status is worth
+// retrying: the server is overloaded or failed temporarily.
+func Retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// RetryAfter parses the Retry-After header which is either seconds or
+// an HTTP date.
+func RetryAfter(h http.Header) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if len(v) == 0 {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
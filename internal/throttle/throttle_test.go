@@ -0,0 +1,114 @@
+package throttle
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(100)
+	if l.Interval() != 10*time.Millisecond {
+		t.Fatalf("want 10ms interval, got %v", l.Interval())
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Wait(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	// the first event is immediate, 9 others are spaced
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("10 events at 100 rps must take at least 90ms, took %v", d)
+	}
+
+	l.SetRate(50, time.Second)
+	if l.Interval() != 20*time.Millisecond {
+		t.Errorf("want 20ms interval, got %v", l.Interval())
+	}
+
+	l = NewLimiter(0)
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		l.Wait(context.Background())
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("unlimited events must not wait, took %v", d)
+	}
+}
+
+func TestLimiter_Wait_canceled(t *testing.T) {
+	l := NewLimiter(1)
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("canceled wait must return early, took %v", d)
+	}
+}
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{Retries: 5, Min: 100 * time.Millisecond, Max: time.Second}
+
+	tests := []struct {
+		retry int
+		min   time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{2, 400 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, time.Second},
+		{10, time.Second},
+	}
+
+	for _, tt := range tests {
+		d := b.Delay(tt.retry)
+		if d < tt.min || d > tt.min+tt.min/2 {
+			t.Errorf("retry %v: want delay in [%v, %v], got %v", tt.retry, tt.min, tt.min+tt.min/2, d)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"seconds", "120", 2 * time.Minute, true},
+		{"date in the past", "Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+		{"missing", "", 0, false},
+		{"junk", "soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if len(tt.header) > 0 {
+				h.Set("Retry-After", tt.header)
+			}
+			got, ok := RetryAfter(h)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("want %v, %v, got %v, %v", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"bitbucket.org/iharsuvorau/ims-publications/cache"
+	"bitbucket.org/iharsuvorau/ims-publications/crossref"
+	"bitbucket.org/iharsuvorau/ims-publications/datacite"
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
+	"bitbucket.org/iharsuvorau/ims-publications/orcid"
+)
+
+// job updates a section of pages with works of users: either the
+// profile page of each user or a single page listing works of all of
+// them.
+type job struct {
+	Name string `yaml:"name" json:"name"`
+	// Category of users, e.g. PI. If there are no users and no category,
+	// all users are taken.
+	Category string `yaml:"category" json:"category"`
+	// Users are titles of user pages, e.g. User:Jane_Doe, which are taken
+	// instead of a category.
+	Users []string `yaml:"users" json:"users"`
+	// Page is the title of a page listing works of all users, co-authored
+	// works are listed once. If it's empty, profile pages of users are
+	// updated.
+	Page     string `yaml:"page" json:"page"`
+	Section  string `yaml:"section" json:"section"`
+	Template string `yaml:"template" json:"template"`
+	// Grouping is the name of a built-in grouper, see groupings.
+	Grouping string     `yaml:"grouping" json:"grouping"`
+	Filter   workFilter `yaml:"filter" json:"filter"`
+	// Purge lists pages whose cache is cleaned after the update, e.g.
+	// pages including the updated one.
+	Purge []string `yaml:"purge" json:"purge"`
+}
+
+// workFilter selects works listed by a job, empty fields select all
+// works.
+type workFilter struct {
+	FromYear int `yaml:"from-year" json:"from-year"`
+	ToYear   int `yaml:"to-year" json:"to-year"`
+	// LastYears selects works of the current year and the previous ones,
+	// e.g. 5 selects works of the last five years.
+	LastYears int `yaml:"last-years" json:"last-years"`
+	// Types are ORCID work types, e.g. journal-article.
+	Types []string `yaml:"types" json:"types"`
+}
+
+// defaultJobs are the jobs run without a jobs file: profile pages of
+// users of the category and the aggregate page of PIs.
+// Templates which are not set are the built-in ones.
+func defaultJobs(category, section, profileGrouping, aggregateGrouping, profileTemplate, aggregateTemplate string) []job {
+	if len(profileTemplate) == 0 {
+		profileTemplate = "publications-list.tmpl"
+	}
+	if len(aggregateTemplate) == 0 {
+		aggregateTemplate = "publications-by-year.tmpl"
+	}
+	return []job{
+		{
+			Name:     "profiles",
+			Category: category,
+			Section:  section,
+			Template: profileTemplate,
+			Grouping: profileGrouping,
+		},
+		{
+			Name:     "PI publications",
+			Category: "PI",
+			Page:     "PI_Publications_By_Year",
+			Section:  "Publications By Year",
+			Template: aggregateTemplate,
+			Grouping: aggregateGrouping,
+			Purge:    []string{"Publications"},
+		},
+	}
+}
+
+// readJobs reads jobs from the file, JSON is expected for files with the
+// .json extension and YAML for others. Templates and groupings which are
+// not set are the ones of the default jobs, templates are paths of files
+// or names of the built-in ones.
+func readJobs(path string) ([]job, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []job{}
+	if err = decodeConfig(path, data, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode jobs %s: %v", path, err)
+	}
+
+	defaults := defaultJobs("", "", "type", "type-year", "", "")
+	for i := range jobs {
+		d := defaults[0]
+		if len(jobs[i].Page) > 0 {
+			d = defaults[1]
+		}
+		if len(jobs[i].Template) == 0 {
+			jobs[i].Template = d.Template
+		}
+		if len(jobs[i].Grouping) == 0 {
+			jobs[i].Grouping = d.Grouping
+		}
+	}
+
+	if err = validateJobs(jobs); err != nil {
+		return nil, fmt.Errorf("invalid jobs %s: %v", path, err)
+	}
+	return jobs, nil
+}
+
+func validateJobs(jobs []job) error {
+	if len(jobs) == 0 {
+		return fmt.Errorf("no jobs")
+	}
+	names := map[string]bool{}
+	for i, j := range jobs {
+		if len(j.Name) == 0 {
+			return fmt.Errorf("job #%d: the name is required", i+1)
+		}
+		if names[j.Name] {
+			return fmt.Errorf("job %q is listed twice", j.Name)
+		}
+		names[j.Name] = true
+		if err := j.validate(); err != nil {
+			return fmt.Errorf("job %q: %v", j.Name, err)
+		}
+	}
+	return nil
+}
+
+func (j job) validate() error {
+	if len(j.Section) == 0 {
+		return fmt.Errorf("the section is required")
+	}
+	if len(j.Category) > 0 && len(j.Users) > 0 {
+		return fmt.Errorf("either a category or users are expected")
+	}
+	known := false
+	for _, name := range groupings {
+		known = known || name == j.Grouping
+	}
+	if !known {
+		return fmt.Errorf("unknown grouping %q, expected one of: %s", j.Grouping, strings.Join(groupings, ", "))
+	}
+	f := j.Filter
+	if f.FromYear < 0 || f.ToYear < 0 || f.LastYears < 0 {
+		return fmt.Errorf("years of the filter must be positive")
+	}
+	if f.FromYear > 0 && f.ToYear > 0 && f.FromYear > f.ToYear {
+		return fmt.Errorf("the filter selects no years: from %d to %d", f.FromYear, f.ToYear)
+	}
+	return nil
+}
+
+// checkTemplates executes templates of the jobs on sample works, so a
+// broken template fails before any page is updated.
+func checkTemplates(jobs []job, tax taxonomy, logger *log.Logger) error {
+	for _, j := range jobs {
+		g, err := newGrouper(j.Grouping, tax, logger)
+		if err != nil {
+			return fmt.Errorf("job %q: %v", j.Name, err)
+		}
+		if err = checkTemplate(j.Template, g); err != nil {
+			return fmt.Errorf("job %q: %v", j.Name, err)
+		}
+	}
+	return nil
+}
+
+// apply returns works selected by the filter. Works without a year are
+// left out if the filter selects years.
+func (f workFilter) apply(works []*orcid.Work, thisYear int) []*orcid.Work {
+	from := f.FromYear
+	if f.LastYears > 0 && thisYear-f.LastYears+1 > from {
+		from = thisYear - f.LastYears + 1
+	}
+	types := map[string]bool{}
+	for _, t := range f.Types {
+		types[t] = true
+	}
+
+	selected := []*orcid.Work{}
+	for _, w := range works {
+		if (from > 0 || f.ToYear > 0) && w.Year == 0 {
+			continue
+		}
+		if w.Year < from || (f.ToYear > 0 && w.Year > f.ToYear) {
+			continue
+		}
+		if len(types) > 0 && !types[w.Type] {
+			continue
+		}
+		selected = append(selected, w)
+	}
+	return selected
+}
+
+// jobRunner runs jobs with clients and options shared by them.
+type jobRunner struct {
+	mwURI             string
+	pub               publisher
+	orcid             *orcid.Client
+	crossref          *crossref.Client
+	datacite          *datacite.Client
+	resolver          *doi.Client
+	cache             *cache.Cache
+	fetchOpts         fetchOptions
+	doiSearch         bool
+	doiMatchThreshold float64
+	overrides         overrides
+	tax               taxonomy
+	logger            *log.Logger
+}
+
+// run explores users of the job, completes their works and updates the
+// pages.
+func (r *jobRunner) run(ctx context.Context, j job) error {
+	g, err := newGrouper(j.Grouping, r.tax, r.logger)
+	if err != nil {
+		return err
+	}
+
+	var users []*user
+	if len(j.Users) > 0 {
+		users, err = exploreUserPages(r.mwURI, j.Users, r.logger)
+	} else {
+		users, err = exploreUsers(r.mwURI, j.Category, r.logger)
+	}
+	if err != nil {
+		return err
+	}
+	r.logger.Printf("%s: users to process: %d", j.Name, len(users))
+
+	if err = r.completeWorks(ctx, users); err != nil {
+		return err
+	}
+
+	return publishJob(r.pub, j, users, g, time.Now().Year(), r.logger)
+}
+
+// completeWorks fetches works of the users, applies overrides and
+// completes works with CrossRef, DataCite and DOI metadata, duplicates
+// are removed and preprints are linked to their published versions.
+func (r *jobRunner) completeWorks(ctx context.Context, users []*user) error {
+	if err := fetchPublicationsIfNeeded(ctx, r.logger, users, r.orcid, r.cache, r.fetchOpts); err != nil {
+		return err
+	}
+
+	if r.doiSearch {
+		if err := recoverDOIs(ctx, r.crossref, r.cache, users, r.doiMatchThreshold, r.logger); err != nil {
+			return err
+		}
+	}
+
+	// DOIs recovered above are matched by overrides too
+	for _, u := range users {
+		r.overrides.apply(u, r.logger)
+	}
+
+	if err := fetchMissingAuthors(ctx, r.crossref, r.datacite, r.resolver, r.cache, r.logger, users); err != nil {
+		return err
+	}
+
+	removeDuplicatedWorks(users, r.logger)
+
+	if err := linkPreprints(ctx, r.crossref, r.cache, users, r.logger); err != nil {
+		return err
+	}
+
+	// fields are overridden last, so completion and merging of
+	// duplicates don't replace them
+	for _, u := range users {
+		r.overrides.modifier(u.OrcID)(u.Works)
+	}
+
+	return nil
+}
+
+// publishJob renders works of the users selected by the filter of the
+// job and updates its pages.
+func publishJob(pub publisher, j job, users []*user, g grouper, thisYear int, logger *log.Logger) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	// works of users are left as they are for other jobs
+	filtered := make([]*user, len(users))
+	for i, u := range users {
+		filtered[i] = &user{Title: u.Title, OrcID: u.OrcID, Works: j.Filter.apply(u.Works, thisYear)}
+	}
+
+	var err error
+	if len(j.Page) == 0 {
+		err = updateProfilePagesWithWorks(pub, j.Section, j.Template, filtered, g, logger)
+	} else {
+		err = updatePageWithWorks(pub, j.Page, j.Section, j.Template, filtered, g, logger)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(j.Purge) > 0 {
+		return pub.Purge(j.Purge...)
+	}
+	return nil
+}
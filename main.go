@@ -1,31 +1,89 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"bitbucket.org/iharsuvorau/ims-publications/cache"
 	"bitbucket.org/iharsuvorau/ims-publications/crossref"
+	"bitbucket.org/iharsuvorau/ims-publications/datacite"
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
 	"bitbucket.org/iharsuvorau/ims-publications/orcid"
 )
 
 func main() {
 	mwBaseURL := flag.String("mediawiki", "https://ims.ut.ee", "mediawiki base URL")
 	crossrefURL := flag.String("crossref", "http://api.crossref.org/v1", "crossref API base URL")
-	orcidURL := flag.String("orcid", "https://pub.orcid.org/v2.1", "orcid API base URL")
+	crossrefMailto := flag.String("crossref-mailto", "", "contact email sent to CrossRef along with requests to use the polite pool of servers")
+	dataciteURL := flag.String("datacite", "https://api.datacite.org", "DataCite API base URL used for DOIs unknown to CrossRef, if it's empty DataCite is not queried")
+	doiResolver := flag.String("doi-resolver", "https://doi.org", "DOI resolver used to get metadata of DOIs unknown to CrossRef by content negotiation, if it's empty DOIs are not resolved")
+	doiSearch := flag.Bool("doi-search", false, "search CrossRef by title, year and the owner's name for works without a DOI")
+	doiMatchThreshold := flag.Float64("doi-match-threshold", 0.85, "minimal confidence from 0 to 1 of a CrossRef search match to apply its DOI, less confident candidates are logged only")
+	crossrefRetries := flag.Int("crossref-retries", 3, "amount of retries of CrossRef requests failed with a network error, the 429 or 5xx status")
+	orcidURL := flag.String("orcid", "https://pub.orcid.org/v2.1", "orcid API base URL, the API version v2.1 or v3.0 is taken from the last path segment")
+	orcidFormat := flag.String("orcid-format", "xml", "media type requested from the ORCID API: xml or json")
+	orcidClientID := flag.String("orcid-client-id", "", "ORCID OAuth client ID, if it's set works are fetched with an access token of the /read-public scope")
+	orcidClientSecret := flag.String("orcid-client-secret", "", "ORCID OAuth client secret")
+	orcidTokenURL := flag.String("orcid-token-url", "", "ORCID OAuth token endpoint, by default it's derived from the -orcid URL")
 	section := flag.String("section", "Publications", "section title for the publication to look for on a user's page or of the new one to add to the page")
 	category := flag.String("category", "", "category of users to update profile pages for, if it's empty all users' pages will be updated")
 	lgName := flag.String("name", "", "login name of the bot for updating pages")
 	lgPass := flag.String("pass", "", "login password of the bot for updating pages")
 	logPath := flag.String("log", "", "specify the filepath for a log file, if it's empty all messages are logged into stdout")
+	dryRun := flag.Bool("dry-run", false, "render pages without logging in or editing MediaWiki, the markup and diffs against the current sections are saved into the -out directory")
+	outDir := flag.String("out", "dry-run", "output directory for the rendered markup in the dry-run mode")
+	cacheDir := flag.String("cache-dir", defaultCacheDir(), "directory for cached ORCID works and CrossRef records")
+	cacheTTL := flag.Duration("cache-ttl", time.Hour*23, "duration during which cached records are used instead of downloading them again")
+	refresh := flag.Bool("refresh", false, "ignore cached records and download everything again")
+	incremental := flag.Bool("incremental", false, "update obsolete cached works by fetching only new and modified ones from ORCID")
+	orcidRate := flag.Float64("orcid-rate", 10, "maximum amount of ORCID requests per second, zero means no limit")
+	orcidRetries := flag.Int("orcid-retries", 3, "amount of retries of ORCID requests failed with a network error, the 429 or 5xx status")
+	strict := flag.Bool("strict", false, "stop if works of a user could not be fetched completely instead of using the fetched ones")
+	timeout := flag.Duration("timeout", 0, "maximum duration of fetching from ORCID and CrossRef, zero means no limit")
+	httpTimeout := flag.Duration("http-timeout", time.Minute, "maximum duration of a single HTTP request to ORCID or CrossRef, zero means no limit")
+	invalidate := flag.String("invalidate", "", "comma-separated list of ORCID iDs whose cached works must be removed before the run")
+	taxonomyPath := flag.String("sections", "", "YAML or JSON file with ordered sections of publications pages: titles, ORCID work types listed in each and hidden sections, by default journal articles, conference papers and other works are listed")
+	profileGrouping := flag.String("profile-grouping", "type", "grouping of works on profile pages: "+strings.Join(groupings, ", "))
+	aggregateGrouping := flag.String("aggregate-grouping", "type-year", "grouping of works on the aggregate page of PIs: "+strings.Join(groupings, ", "))
+	profileTemplate := flag.String("profile-template", "", "template file of profile pages, by default the built-in publications-list.tmpl is used")
+	aggregateTemplate := flag.String("aggregate-template", "", "template file of the aggregate page of PIs, by default the built-in publications-by-year.tmpl is used")
+	jobsPath := flag.String("jobs", "", "YAML or JSON file with jobs updating pages: users of a category or listed ones, the target page, section, template, grouping, filters of works and pages to purge; by default profile pages of the -category users and the aggregate page of PIs are updated")
+	overridesPath := flag.String("overrides", "", "YAML or JSON file with manual overrides of works keyed by ORCID iDs: hidden, corrected and pinned works")
+	flag.Usage = usage
 	flag.Parse()
 
-	flagsStringFatalCheck(mwBaseURL, crossrefURL, section, lgName, lgPass)
+	localCache, err := cache.New(*cacheDir, *cacheTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if flag.NArg() > 0 {
+		// -refresh is ignored, otherwise prune would remove every entry
+		if err = runCommand(localCache, flag.Args(), os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *refresh {
+		localCache.Refresh()
+		// everything must be downloaded again
+		*incremental = false
+	}
+
+	flagsStringFatalCheck(mwBaseURL, crossrefURL, section)
+	if !*dryRun {
+		flagsStringFatalCheck(lgName, lgPass)
+	}
 
 	var logger *log.Logger
 	if len(*logPath) > 0 {
@@ -39,93 +97,140 @@ func main() {
 		logger = log.New(os.Stdout, "", log.LstdFlags)
 	}
 
-	//
-	// Publications for each user
-	//
-
-	// TODO: a general issue for many functions — if we pass a logger to a function, it shouldn't return an error, it should log it
-
-	users, err := exploreUsers(*mwBaseURL, *category, logger)
-	if err != nil {
-		logger.Fatal(err)
-	}
-	logger.Printf("users to update: %+v", len(users))
-
-	orcidClient, err := orcid.New(*orcidURL)
-	if err != nil {
-		logger.Fatal(err)
+	var pub publisher
+	if *dryRun {
+		flagsStringFatalCheck(outDir)
+		p, err := newDryRunPublisher(*mwBaseURL, *outDir, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		pub = p
+	} else {
+		pub = &wikiPublisher{mwURI: *mwBaseURL, lgName: *lgName, lgPass: *lgPass}
 	}
 
-	if err = fetchPublicationsIfNeeded(logger, users, orcidClient); err != nil {
-		logger.Fatal(err)
+	tax := defaultTaxonomy
+	if len(*taxonomyPath) > 0 {
+		if tax, err = readTaxonomy(*taxonomyPath); err != nil {
+			logger.Fatal(err)
+		}
 	}
 
-	// crossref part
-	crossrefClient, err := crossref.New(*crossrefURL)
-	if err != nil {
+	jobs := defaultJobs(*category, *section, *profileGrouping, *aggregateGrouping, *profileTemplate, *aggregateTemplate)
+	if len(*jobsPath) > 0 {
+		if jobs, err = readJobs(*jobsPath); err != nil {
+			logger.Fatal(err)
+		}
+	} else if err = validateJobs(jobs); err != nil {
 		logger.Fatal(err)
 	}
-	err = fetchMissingAuthors(crossrefClient, logger, users)
-	if err != nil {
+	if err = checkTemplates(jobs, tax, logger); err != nil {
 		logger.Fatal(err)
 	}
 
-	// TODO: there is orcid.WorksModifier for such kind of manipulations
-	removeDuplicatedWorks(users, logger)
-
-	// saving XML for each user
-	{
-		var fpath string
-		var err error
-		var obsoleteDuration = time.Hour * 23 // TODO: time condition should be passed by a caller
-		for _, u := range users {
-			fpath = u.OrcID.String() + ".xml"
-			if !isFileNew(fpath, obsoleteDuration) { // saves once in 23 hours
-				err = dumpUserWorksXML(u)
-				if err != nil {
-					log.Fatal(err)
-				}
-			}
+	var workOverrides overrides
+	if len(*overridesPath) > 0 {
+		if workOverrides, err = readOverrides(*overridesPath); err != nil {
+			logger.Fatal(err)
 		}
 	}
 
-	// used by the template in updateProfilePagesWithWorks
-	updateContributorsLine(users) // TODO: make cleaner, hide this detail
-
-	err = updateProfilePagesWithWorks(*mwBaseURL, *lgName, *lgPass, *section, users, logger)
-	if err != nil {
-		logger.Fatal(err)
+	for _, s := range strings.Split(*invalidate, ",") {
+		if len(strings.TrimSpace(s)) == 0 {
+			continue
+		}
+		id, err := orcid.IDFromURL(strings.TrimSpace(s))
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if err = localCache.Invalidate(worksCacheKey(id)); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Printf("cached works are invalidated for %v", id)
 	}
 
-	//
-	// Publications on the Publications page
-	//
-
-	// TODO: repetitive section of code
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	httpClient := &http.Client{Timeout: *httpTimeout}
+
+	var format orcid.Format
+	switch *orcidFormat {
+	case "xml":
+		format = orcid.XML
+	case "json":
+		format = orcid.JSON
+	default:
+		logger.Fatalf("unsupported ORCID format: %s", *orcidFormat)
+	}
 
-	usersPI, err := exploreUsers(*mwBaseURL, "PI", logger)
-	if err != nil {
-		log.Fatal(err)
+	orcidOpts := []orcid.Option{
+		orcid.WithFormat(format),
+		orcid.WithRateLimit(*orcidRate),
+		orcid.WithRetries(*orcidRetries),
+		orcid.WithHTTPClient(httpClient),
+	}
+	if len(*orcidClientID) > 0 {
+		flagsStringFatalCheck(orcidClientSecret)
+		orcidOpts = append(orcidOpts, orcid.WithCredentials(*orcidClientID, *orcidClientSecret))
+		if len(*orcidTokenURL) > 0 {
+			orcidOpts = append(orcidOpts, orcid.WithTokenURL(*orcidTokenURL))
+		}
 	}
-	logger.Printf("PI users to process: %+v", len(usersPI))
 
-	if err = fetchPublicationsIfNeeded(logger, usersPI, orcidClient); err != nil {
+	orcidClient, err := orcid.New(*orcidURL, orcidOpts...)
+	if err != nil {
 		logger.Fatal(err)
 	}
+	fetchOpts := fetchOptions{incremental: *incremental, strict: *strict}
 
-	err = fetchMissingAuthors(crossrefClient, logger, usersPI)
+	// crossref part
+	crossrefClient, err := crossref.New(*crossrefURL,
+		crossref.WithMailto(*crossrefMailto),
+		crossref.WithRetries(*crossrefRetries),
+		crossref.WithHTTPClient(httpClient))
 	if err != nil {
 		logger.Fatal(err)
 	}
 
-	removeDuplicatedWorks(usersPI, logger)
+	var dataciteClient *datacite.Client
+	if len(*dataciteURL) > 0 {
+		dataciteClient, err = datacite.New(*dataciteURL, datacite.WithHTTPClient(httpClient))
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
 
-	// used by the template in updateProfilePagesWithWorks
-	updateContributorsLine(usersPI) // TODO: make cleaner, hide this detail
+	var resolver *doi.Client
+	if len(*doiResolver) > 0 {
+		resolver, err = doi.New(*doiResolver, doi.WithHTTPClient(httpClient))
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
 
-	err = updatePublicationsByYearWithWorks(*mwBaseURL, *lgName, *lgPass, usersPI, logger, crossrefClient)
-	if err != nil {
-		logger.Fatal(err)
+	runner := &jobRunner{
+		mwURI:             *mwBaseURL,
+		pub:               pub,
+		orcid:             orcidClient,
+		crossref:          crossrefClient,
+		datacite:          dataciteClient,
+		resolver:          resolver,
+		cache:             localCache,
+		fetchOpts:         fetchOpts,
+		doiSearch:         *doiSearch,
+		doiMatchThreshold: *doiMatchThreshold,
+		overrides:         workOverrides,
+		tax:               tax,
+		logger:            logger,
+	}
+	for _, j := range jobs {
+		if err = runner.run(ctx, j); err != nil {
+			logger.Fatal(err)
+		}
 	}
 }
 
@@ -137,16 +242,19 @@ func flagsStringFatalCheck(ss ...*string) {
 	}
 }
 
-func dumpUserWorksXML(u *user) error {
-	fpath := u.OrcID.String() + ".xml"
-	f, err := os.Create(fpath)
+func dumpUserWorksXML(c *cache.Cache, u *user) error {
+	key := worksCacheKey(u.OrcID)
+	f, err := c.Create(key)
 	if err != nil {
-		return fmt.Errorf("failed to create file %s: %v", fpath, err)
+		return fmt.Errorf("failed to create file %s: %v", c.Path(key), err)
 	}
 	if err = xml.NewEncoder(f).Encode(u.Works); err != nil {
+		f.Discard()
 		return fmt.Errorf("failed to encode xml: %+v", err)
 	}
-	f.Close()
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("failed to write file %s: %v", c.Path(key), err)
+	}
 	return nil
 }
 
@@ -183,60 +291,58 @@ func readUserJSON(u *user, fpath string) error {
 	return json.NewDecoder(f).Decode(&u)
 }
 
-// isFileNew checks the existence of a file and its modification time
-// and returns true if it was modified during the previous maxDuration
-// hours.
-func isFileNew(fpath string, maxDuration time.Duration) bool {
-	stat, err := os.Stat(fpath)
-	if err != nil {
-		return false
-	}
-
-	return time.Since(stat.ModTime()) < maxDuration
-}
-
-// updateContributorsLine populates a slice of works with an URI for
-// external ids if its value is missing.
-func updateContributorsLine(users []*user) {
-	for _, u := range users {
-		for _, w := range u.Works {
-			contribs := make([]string, len(w.Contributors))
-			for ii, c := range w.Contributors {
-				contribs[ii] = c.Name
-			}
-
-			// formatting of contributors is according to
-			// https://research.moreheadstate.edu/c.php?g=107001&p=695197
-			w.ContributorsLine = strings.Join(contribs, ", ")
-		}
-
-	}
-
+// fetchOptions controls how works are fetched from ORCID.
+type fetchOptions struct {
+	// incremental makes obsolete cached works synchronized with ORCID
+	// instead of downloading all of them.
+	incremental bool
+	// strict makes works which could not be fetched an error instead
+	// of reporting them and using the rest.
+	strict bool
 }
 
-func fetchPublicationsIfNeeded(logger *log.Logger, users []*user, orcidClient *orcid.Client) error {
+// fetchPublicationsIfNeeded reads works of the users from the cache if
+// they are fresh, otherwise it downloads works from ORCID and caches
+// them. Partially fetched works are reported and used, but they are not
+// cached, so they are fetched again by the next run.
+func fetchPublicationsIfNeeded(ctx context.Context, logger *log.Logger, users []*user, orcidClient *orcid.Client, c *cache.Cache, opts fetchOptions) error {
 	if len(users) == 0 {
 		return nil
 	}
 
 	var err error
-	var fpath string
-	// files become obsolete 1 hour before the next cron run
-	var obsoleteDuration = time.Hour * 23 // TODO: time condition should be passed by a caller
+	var key string
 
 	for _, u := range users { // TODO: use goroutines
-		fpath = u.OrcID.String() + ".xml"
-		if isFileNew(fpath, obsoleteDuration) {
-			logger.Printf("reading from a file for %v", u.Title)
-			u.Works, err = orcid.ReadWorks(fpath)
+		key = worksCacheKey(u.OrcID)
+		if c.IsFresh(key) {
+			logger.Printf("reading from the cache for %v", u.Title)
+			u.Works, err = orcid.ReadWorks(c.Path(key))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if opts.incremental && c.Exists(key) {
+			err = syncPublications(ctx, logger, u, orcidClient, c.Path(key))
 		} else {
 			logger.Printf("fetching works from ORCID for %v", u.Title)
-			u.Works, err = orcid.FetchWorks(orcidClient, u.OrcID, logger,
+			u.Works, err = orcid.FetchWorks(ctx, orcidClient, u.OrcID, logger,
 				orcid.UpdateExternalIDsURL,
-				orcid.UpdateContributorsLine,
 				orcid.UpdateMarkup)
 		}
+
+		var partial *orcid.PartialError
+		if errors.As(err, &partial) && !opts.strict {
+			logger.Printf("works of %v are fetched partially, %v", u.Title, partial)
+			continue
+		}
 		if err != nil {
+			return fmt.Errorf("failed to fetch works of %v: %v", u.Title, err)
+		}
+
+		if err = dumpUserWorksXML(c, u); err != nil {
 			return err
 		}
 	}
@@ -244,21 +350,82 @@ func fetchPublicationsIfNeeded(logger *log.Logger, users []*user, orcidClient *o
 	return nil
 }
 
-func fetchMissingAuthors(cref *crossref.Client, logger *log.Logger, users []*user) error {
+// syncPublications updates obsolete cached works of the user with
+// ORCID fetching only new and modified works.
+func syncPublications(ctx context.Context, logger *log.Logger, u *user, orcidClient *orcid.Client, fpath string) error {
+	cached, err := orcid.ReadWorks(fpath)
+	if err != nil {
+		return err
+	}
+
+	logger.Printf("synchronizing works with ORCID for %v", u.Title)
+	works, report, err := orcid.SyncWorks(ctx, orcidClient, u.OrcID, cached, logger,
+		orcid.UpdateExternalIDsURL,
+		orcid.UpdateMarkup)
+	if report != nil {
+		logger.Printf("works of %v are synchronized, %v", u.Title, report)
+	}
+
+	u.Works = works
+	return err
+}
+
+func fetchMissingAuthors(ctx context.Context, cref *crossref.Client, dc *datacite.Client, resolver *doi.Client, c *cache.Cache, logger *log.Logger, users []*user) error {
 	logger.Println("starting crossref authors checking")
 	start := time.Now()
 	defer func() {
 		logger.Println("crossref authors checking has been finished in", time.Since(start))
 	}()
 
+	prefetched := prefetchCrossRefWorks(ctx, cref, c, users, logger)
+
 	for _, u := range users {
 		for _, w := range u.Works {
-			// skip if there are authors already
-			if len(w.Contributors) > 0 {
+			// skip if there are authors and other fields already
+			if len(w.Contributors) > 0 && !missingMetadata(w) {
 				continue
 			}
 
-			w.Contributors = crossRefContributors(w, cref, logger)
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("crossref authors checking is interrupted: %v", err)
+			}
+
+			// other registries are asked only about DOIs which
+			// CrossRef doesn't know
+			unknown := false
+			if id, err := w.DOI(); err != nil {
+				logger.Printf("publication doesn't have DOI: %v", w.Title)
+			} else if work, err := lookupCrossRefWork(ctx, cref, c, prefetched, id, logger); err != nil {
+				unknown = errors.Is(err, crossref.ErrNotFound)
+				logger.Printf("crossref fetch error: %v", err)
+			} else {
+				if len(w.Contributors) == 0 {
+					w.Contributors = contributorsFromCrossRef(work)
+				}
+				completeWithCrossRef(w, work)
+			}
+
+			// datasets and software are often registered with
+			// DataCite
+			if unknown && (len(w.Contributors) == 0 || missingMetadata(w)) && dc != nil {
+				if work := dataCiteWork(ctx, w, dc, c, logger); work != nil {
+					if len(w.Contributors) == 0 {
+						w.Contributors = contributorsFromDataCite(work)
+					}
+					completeWithDataCite(w, work)
+				}
+			}
+
+			// DOIs of other registration agencies are resolved
+			// with content negotiation
+			if unknown && (len(w.Contributors) == 0 || missingMetadata(w)) && resolver != nil {
+				if work := doiWork(ctx, w, resolver, c, logger); work != nil {
+					if len(w.Contributors) == 0 {
+						w.Contributors = contributorsFromDOI(work)
+					}
+					completeWithDOI(w, work)
+				}
+			}
 
 			// skip if there are authors already
 			if len(w.Contributors) > 0 {
@@ -272,37 +439,36 @@ func fetchMissingAuthors(cref *crossref.Client, logger *log.Logger, users []*use
 	return nil
 }
 
+// removeDuplicatedWorks merges duplicated works of each user, see
+// dedupWorks, and logs what was merged.
 func removeDuplicatedWorks(users []*user, logger *log.Logger) {
 	for _, u := range users {
-		if works, err := filterDuplicatedWorksByDOI(u.Works, logger); err != nil {
-			logger.Printf("failed to remove duplicates by DOI for %v: %v", u.OrcID, err)
-		} else {
-			u.Works = works
+		works, merges := dedupWorks(u.Works)
+		for _, m := range merges {
+			logger.Printf("duplicates of %v %s", u.OrcID, m)
 		}
+		u.Works = works
 	}
 }
 
 func filterDuplicatedWorksByDOI(works []*orcid.Work, logger *log.Logger) ([]*orcid.Work, error) {
-	m := make(map[string]bool)
+	m := make(map[doi.DOI]bool)
 	uniqueWorks := []*orcid.Work{}
 
 	for _, w := range works {
 		// skipping a work without DOI
-		if !w.HasDOI() {
+		id, err := w.DOI()
+		if err != nil {
 			uniqueWorks = append(uniqueWorks, w)
 			continue
 		}
 
-		id := w.GetDOI()
-		if id == nil {
-			return uniqueWorks, fmt.Errorf("DOI must exist, but nil is returned for %v", w.Title)
-		}
-
-		if _, ok := m[id.Value]; !ok {
-			m[id.Value] = true
+		// DOIs are canonical, so differently written ones are equal
+		if !m[id] {
+			m[id] = true
 			uniqueWorks = append(uniqueWorks, w)
 		} else {
-			logger.Printf("skipping a duplicate: %v", id.Value)
+			logger.Printf("skipping a duplicate: %v", id)
 		}
 
 	}
@@ -311,24 +477,24 @@ func filterDuplicatedWorksByDOI(works []*orcid.Work, logger *log.Logger) ([]*orc
 }
 
 func reportDuplicatedWorksByDOI(u *user, logger *log.Logger) (unique []string, dups []string) {
-	type doi string
-	m := make(map[doi]*orcid.Work)
+	m := make(map[doi.DOI]*orcid.Work)
 	unique = []string{}
 	dups = []string{}
 
 	for _, w := range u.Works {
-		if !w.HasDOI() && len(w.ExternalIDs) > 0 {
-			unique = append(unique, w.ExternalIDs[0].Value)
+		id, err := w.DOI()
+		if err != nil {
+			if len(w.ExternalIDs) > 0 {
+				unique = append(unique, w.ExternalIDs[0].Value)
+			}
 			continue
 		}
 
-		id := w.GetDOI()
-
-		if _, ok := m[doi(id.Value)]; !ok {
-			m[doi(id.Value)] = w
-			unique = append(unique, id.Value)
+		if _, ok := m[id]; !ok {
+			m[id] = w
+			unique = append(unique, id.String())
 		} else {
-			dups = append(dups, id.Value)
+			dups = append(dups, id.String())
 		}
 	}
 
@@ -1,12 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"bitbucket.org/iharsuvorau/ims-publications/cache"
 	"bitbucket.org/iharsuvorau/ims-publications/crossref"
+	"bitbucket.org/iharsuvorau/ims-publications/datacite"
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
 	"bitbucket.org/iharsuvorau/ims-publications/orcid"
 )
 
@@ -74,6 +86,18 @@ import (
 // 	}
 // }
 
+func newTestCache(t *testing.T) *cache.Cache {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cache.New(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
 func Test_groupByTypeAndYear(t *testing.T) {
 	ids := []string{
 		"https://orcid.org/0000-0002-1720-1509",
@@ -95,7 +119,7 @@ func Test_groupByTypeAndYear(t *testing.T) {
 			t.Error(err)
 		}
 
-		works, err := orcid.FetchWorks(client, oid, logger)
+		works, err := orcid.FetchWorks(context.Background(), client, oid, logger)
 		if err != nil {
 			t.Error(err)
 		}
@@ -104,7 +128,7 @@ func Test_groupByTypeAndYear(t *testing.T) {
 			t.Error("amount of works must be bigger than zero")
 		}
 
-		byTypeAndYear := groupByTypeAndYear(works, logger)
+		byTypeAndYear := groupByTypeAndYear(works, defaultTaxonomy, logger)
 		//t.Logf("result: %+v", byTypeAndYear)
 
 		markup, err := renderTmpl(byTypeAndYear, "publications-by-year.tmpl")
@@ -143,7 +167,7 @@ func Test_getMissingAuthorsCrossRef(t *testing.T) {
 			t.Error(err)
 		}
 
-		works, err := orcid.FetchWorks(orcl, oid, logger)
+		works, err := orcid.FetchWorks(context.Background(), orcl, oid, logger)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -152,11 +176,22 @@ func Test_getMissingAuthorsCrossRef(t *testing.T) {
 			t.Error("amount of works must be bigger than zero")
 		}
 
-		t.Logf("contributors before: %+v", works[0].Contributors)
+		t.Logf("work before: %+v", works[0])
 
-		works[0].Contributors = crossRefContributors(works[0], cref, logger)
+		id, err := works[0].DOI()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if work, err := getCrossRefWork(context.Background(), cref, nil, id, logger); err != nil {
+			t.Error(err)
+		} else {
+			if len(works[0].Contributors) == 0 {
+				works[0].Contributors = contributorsFromCrossRef(work)
+			}
+			completeWithCrossRef(works[0], work)
+		}
 
-		t.Logf("contributors after: %+v", works[0].Contributors)
+		t.Logf("work after: %+v", works[0])
 	}
 }
 
@@ -178,7 +213,10 @@ func Test_fetchPublicationsAndMissingAuthors(t *testing.T) {
 		t.Error(err)
 	}
 
-	err = fetchPublicationsIfNeeded(logger, users, orcl)
+	c := newTestCache(t)
+	defer os.RemoveAll(c.Dir())
+
+	err = fetchPublicationsIfNeeded(context.Background(), logger, users, orcl, c, fetchOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -211,7 +249,7 @@ func Test_fetchPublicationsAndMissingAuthors(t *testing.T) {
 		log.Fatal(err)
 	}
 
-	err = fetchMissingAuthors(cref, logger, users)
+	err = fetchMissingAuthors(context.Background(), cref, nil, nil, c, logger, users)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -382,17 +420,15 @@ func Test_unescapedDoiURL(t *testing.T) {
 	}
 
 	for _, u := range filteredUsers {
-		u.Works, err = orcid.FetchWorks(orcidClient, u.OrcID, logger,
-			orcid.UpdateExternalIDsURL, orcid.UpdateContributorsLine, orcid.UpdateMarkup)
+		u.Works, err = orcid.FetchWorks(context.Background(), orcidClient, u.OrcID, logger,
+			orcid.UpdateExternalIDsURL, orcid.UpdateMarkup)
 		if err != nil {
 			t.Error(err)
 		}
 	}
 
-	updateContributorsLine(filteredUsers)
-
 	for _, u := range filteredUsers {
-		byTypeAndYear := groupByTypeAndYear(u.Works, logger)
+		byTypeAndYear := groupByTypeAndYear(u.Works, defaultTaxonomy, logger)
 
 		markup, err := renderTmpl(byTypeAndYear, "publications-list.tmpl")
 		if err != nil {
@@ -544,7 +580,10 @@ func Test_dumpUserJSON_and_readUserJSON(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err = fetchPublicationsIfNeeded(logger, usersFiltered, orcidClient); err != nil {
+	c := newTestCache(t)
+	defer os.RemoveAll(c.Dir())
+
+	if err = fetchPublicationsIfNeeded(context.Background(), logger, usersFiltered, orcidClient, c, fetchOptions{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -570,3 +609,1620 @@ func Test_dumpUserJSON_and_readUserJSON(t *testing.T) {
 		t.Fatal("dumped and read back data is different")
 	}
 }
+
+func Test_unifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want string
+	}{
+		{
+			name: "A",
+			from: "a\nb\nc\n",
+			to:   "a\nb\nc\n",
+			want: "",
+		},
+		{
+			name: "B",
+			from: "",
+			to:   "a\nb\n",
+			want: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "C",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			to:   "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11\n12\n",
+			want: "--- old\n+++ new\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "D",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			to:   "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			want: "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,3 @@\n 9\n 10\n 11\n-12\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unifiedDiff("old", "new", tt.from, tt.to)
+			if got != tt.want {
+				t.Errorf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_dryRunPublisher(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.FormValue("action") != "parse" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		}
+		switch r.FormValue("prop") {
+		case "sections":
+			fmt.Fprint(w, `{"parse":{"sections":[{"level":"2","line":"About","index":"1"},{"level":"2","line":"Publications","index":"2"}]}}`)
+		case "wikitext":
+			if r.FormValue("section") != "2" {
+				t.Errorf("want section 2, got %s", r.FormValue("section"))
+			}
+			fmt.Fprint(w, `{"parse":{"wikitext":{"*":"== Publications ==\n\n* old\n"}}}`)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "dry-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+	pub, err := newDryRunPublisher(srv.URL, dir, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = pub.UpdateSection("User:Jane_Doe", "Publications", "* new\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err = pub.Purge("Publications"); err != nil {
+		t.Fatal(err)
+	}
+
+	markup, err := ioutil.ReadFile(filepath.Join(dir, "User_Jane_Doe.wiki"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "== Publications ==\n\n* new\n"; string(markup) != want {
+		t.Errorf("want markup %q, got %q", want, markup)
+	}
+
+	diff, err := ioutil.ReadFile(filepath.Join(dir, "User_Jane_Doe.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(diff), "-* old\n+* new\n") {
+		t.Errorf("unexpected diff: %s", diff)
+	}
+}
+
+func Test_getSectionMarkup(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("prop") {
+		case "sections":
+			fmt.Fprint(w, `{"parse":{"sections":[{"level":"2","line":"About","index":"1"},{"level":"2","line":"Publications","index":"2"},
+				{"level":"3","line":"Talks","index":"3"},{"level":"2","line":"Publications","index":"4"}]}}`)
+		case "wikitext":
+			fmt.Fprintf(w, `{"parse":{"wikitext":{"*":"section %s"}}}`, r.FormValue("section"))
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		section string
+		want    string
+	}{
+		// the last one of sections with the same title is edited by
+		// mediawiki.UpdatePage
+		{name: "A", section: "Publications", want: "section 4"},
+		{name: "B", section: "Talks", want: ""},
+		{name: "C", section: "Missing", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getSectionMarkup(srv.URL, "User:Jane_Doe", tt.section)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_runCommand(t *testing.T) {
+	c := newTestCache(t)
+	defer os.RemoveAll(c.Dir())
+
+	for _, key := range []string{"orcid/0000-0002-0183-1282.xml", "crossref/10.1000%2F1.json"} {
+		f, err := c.Create(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	old := time.Now().Add(-time.Hour * 2)
+	if err := os.Chtimes(c.Path("crossref/10.1000%2F1.json"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "list",
+			args: []string{"cache", "list"},
+			want: []string{"crossref/10.1000%2F1.json", "obsolete", "orcid/0000-0002-0183-1282.xml", "fresh"},
+		},
+		{
+			name: "prune",
+			args: []string{"cache", "prune"},
+			want: []string{"crossref/10.1000%2F1.json", "1 entries removed"},
+		},
+		{
+			name:    "unknown",
+			args:    []string{"cache", "clear"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runCommand(c, tt.args, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(out.String(), s) {
+					t.Errorf("want %q in the output:\n%s", s, out.String())
+				}
+			}
+		})
+	}
+
+	if c.Exists("crossref/10.1000%2F1.json") || !c.Exists("orcid/0000-0002-0183-1282.xml") {
+		t.Error("only the obsolete entry must be pruned")
+	}
+}
+
+func Test_completeWithCrossRef(t *testing.T) {
+	cw := &crossref.Work{
+		Type:           "proceedings-article",
+		ContainerTitle: "Proceedings of the Conference",
+		Issued:         crossref.Date{Year: 2019, Month: 5},
+		Published:      crossref.Date{Year: 2020},
+	}
+
+	tests := []struct {
+		name string
+		work *orcid.Work
+		want *orcid.Work
+	}{
+		{
+			name: "A",
+			work: &orcid.Work{Type: "other"},
+			want: &orcid.Work{Type: "conference-paper", JournalTitle: "Proceedings of the Conference", Year: 2019, Month: 5},
+		},
+		{
+			name: "B",
+			work: &orcid.Work{Type: "journal-article", JournalTitle: "Journal", Year: 2018, Month: 1, Day: 2},
+			want: &orcid.Work{Type: "journal-article", JournalTitle: "Journal", Year: 2018, Month: 1, Day: 2},
+		},
+		{
+			name: "C",
+			work: &orcid.Work{Year: 2018},
+			want: &orcid.Work{Type: "conference-paper", JournalTitle: "Proceedings of the Conference", Year: 2018},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completeWithCrossRef(tt.work, cw)
+			if !reflect.DeepEqual(tt.work, tt.want) {
+				t.Errorf("completeWithCrossRef() = %+v, want %+v", tt.work, tt.want)
+			}
+			if missingMetadata(tt.work) {
+				t.Errorf("missingMetadata() = true for %+v", tt.work)
+			}
+		})
+	}
+}
+
+func Test_citeAuthors(t *testing.T) {
+	contribs := []*orcid.Contributor{
+		{Name: "Jane Doe", ORCID: "0000-0002-0183-1282"},
+		{Name: "Smith, Adam Bob"},
+		{Name: "R. Roe", GivenName: "Richard", FamilyName: "Roe"},
+	}
+
+	tests := []struct {
+		name     string
+		style    string
+		contribs []*orcid.Contributor
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "A",
+			style:    "apa",
+			contribs: contribs,
+			want:     "[https://orcid.org/0000-0002-0183-1282 Doe, J.], Smith, A. B., & Roe, R.",
+		},
+		{
+			name:     "B",
+			style:    "ieee",
+			contribs: contribs,
+			want:     "[https://orcid.org/0000-0002-0183-1282 J. Doe], A. B. Smith, and R. Roe",
+		},
+		{
+			name:     "C",
+			style:    "vancouver",
+			contribs: contribs,
+			want:     "[https://orcid.org/0000-0002-0183-1282 Doe J], Smith AB, Roe R",
+		},
+		{
+			name:     "D",
+			style:    "apa",
+			contribs: contribs[1:],
+			want:     "Smith, A. B., & Roe, R.",
+		},
+		{
+			name:     "E",
+			style:    "ieee",
+			contribs: []*orcid.Contributor{{Name: "Consortium"}},
+			want:     "Consortium",
+		},
+		{
+			name:    "F",
+			style:   "mla",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := citeAuthors(tt.style, tt.contribs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("citeAuthors() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("citeAuthors() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_contributorsFromCrossRef(t *testing.T) {
+	work := &crossref.Work{Authors: []crossref.Author{
+		{Given: "Jane", Family: "Doe", ORCID: "http://orcid.org/0000-0002-0183-1282", Sequence: "first"},
+		{Name: "Consortium", Sequence: "additional"},
+	}}
+
+	want := []*orcid.Contributor{
+		{Name: "Jane Doe", GivenName: "Jane", FamilyName: "Doe", ORCID: "0000-0002-0183-1282", Sequence: "first", Role: "author"},
+		{Name: "Consortium", Sequence: "additional", Role: "author"},
+	}
+	if got := contributorsFromCrossRef(work); !reflect.DeepEqual(got, want) {
+		t.Errorf("contributorsFromCrossRef() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_titleSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want float64
+	}{
+		{name: "A", a: "Soft Actuators", b: "soft actuators.", want: 1},
+		{name: "B", a: "CO</nowiki>{{sub|2}}<nowiki> Capture", b: "CO2 capture", want: 1},
+		{name: "C", a: "Soft Actuators", b: "Hard Actuators", want: 0.5},
+		{name: "D", a: "", b: "Soft Actuators", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := titleSimilarity(tt.a, tt.b); got != tt.want {
+				t.Errorf("titleSimilarity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_recoverDOIs(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var items string
+		switch q := r.URL.Query().Get("query.bibliographic"); q {
+		case "Soft Actuators 2018":
+			items = `{"DOI":"10.1000/weak","title":["Actuators"],"issued":{"date-parts":[[2015]]}},
+				{"DOI":"10.1000/soft","title":["Soft actuators"],"issued":{"date-parts":[[2018]]},"author":[{"given":"Jane","family":"Doe"}]}`
+		case "Hard Actuators 2018":
+			items = `{"DOI":"10.1000/hard","title":["Hard actuators and sensors"],"issued":{"date-parts":[[2016]]},"author":[{"given":"John","family":"Roe"}]}`
+		}
+		fmt.Fprintf(w, `{"status":"ok","message-type":"work-list","message":{"items":[%s]}}`, items)
+	}))
+	defer srv.Close()
+
+	cref, err := crossref.New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := &user{
+		Title: "User:Jane Doe",
+		Works: []*orcid.Work{
+			{Title: "Soft Actuators", Year: 2018},
+			{Title: "Hard Actuators", Year: 2018},
+			{Title: "Has DOI", ExternalIDs: []orcid.ExternalID{{Type: "doi", Value: "10.1000/has"}}},
+		},
+	}
+
+	c := newTestCache(t)
+	if err = recoverDOIs(context.Background(), cref, c, []*user{u}, 0.85, logger); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := u.Works[0].GetDOI(); got == nil || got.Value != "10.1000/soft" || u.Works[0].DoiURI != "https://doi.org/10.1000/soft" {
+		t.Errorf("want the confident DOI applied, got %+v", u.Works[0])
+	}
+	if _, err := u.Works[1].DOI(); err == nil {
+		t.Errorf("want no DOI for a weak match, got %+v", u.Works[1].ExternalIDs)
+	}
+	if len(u.Works[2].ExternalIDs) != 1 {
+		t.Errorf("works with a DOI must be left as they are, got %+v", u.Works[2].ExternalIDs)
+	}
+
+	entries, err := c.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("want 2 cached searches, got %+v", entries)
+	}
+}
+
+func Test_fetchMissingAuthors_batch(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/works" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok","message-type":"work-list","message":{"total-results":2,"items":[
+			{"DOI":"10.1000/a","container-title":["Journal A"],"author":[{"given":"Jane","family":"Doe"}]},
+			{"DOI":"10.1000/b","container-title":["Journal B"],"author":[{"given":"John","family":"Roe"}]}]}}`)
+	}))
+	defer srv.Close()
+
+	cref, err := crossref.New(srv.URL, crossref.WithRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := []*user{
+		{Title: "User:Jane Doe", Works: []*orcid.Work{
+			{Title: "A", Year: 2019, Type: "journal-article", DoiURI: "https://doi.org/10.1000/a"},
+		}},
+		{Title: "User:John Roe", Works: []*orcid.Work{
+			{Title: "B", Year: 2019, Type: "journal-article", DoiURI: "https://doi.org/10.1000/b"},
+		}},
+	}
+
+	c := newTestCache(t)
+	if err = fetchMissingAuthors(context.Background(), cref, nil, nil, c, logger, users); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 1 {
+		t.Errorf("want a single batch request, got %v", requests)
+	}
+	if w := users[0].Works[0]; w.JournalTitle != "Journal A" || len(w.Contributors) != 1 || w.Contributors[0].Name != "Jane Doe" {
+		t.Errorf("unexpected work: %+v", w)
+	}
+	if w := users[1].Works[0]; w.JournalTitle != "Journal B" || len(w.Contributors) != 1 || w.Contributors[0].Name != "John Roe" {
+		t.Errorf("unexpected work: %+v", w)
+	}
+}
+
+func Test_fetchMissingAuthors_prefetched(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/works" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok","message-type":"work-list","message":{"total-results":1,"items":[
+			{"DOI":"10.1000/a","container-title":["Journal A"],"author":[{"given":"Jane","family":"Doe"}]}]}}`)
+	}))
+	defer srv.Close()
+
+	cref, err := crossref.New(srv.URL, crossref.WithRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newUsers := func() []*user {
+		return []*user{{Title: "User:Jane Doe", Works: []*orcid.Work{
+			{Title: "A", Year: 2019, Type: "journal-article", DoiURI: "https://doi.org/10.1000/a"},
+			{Title: "Unknown", Year: 2019, Type: "journal-article", DoiURI: "https://doi.org/10.1000/unknown"},
+		}}}
+	}
+
+	tests := []struct {
+		name  string
+		cache *cache.Cache
+		// requests are the amount of requests of two runs
+		requests int
+	}{
+		// the batch is used without the cache and the unknown DOI is
+		// not requested alone
+		{name: "A", requests: 2},
+		// nothing is requested by the second run, the unknown DOI is
+		// cached as missing
+		{name: "B", cache: newTestCache(t), requests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			for run := 0; run < 2; run++ {
+				users := newUsers()
+				if err := fetchMissingAuthors(context.Background(), cref, nil, nil, tt.cache, logger, users); err != nil {
+					t.Fatal(err)
+				}
+				if w := users[0].Works[0]; w.JournalTitle != "Journal A" || len(w.Contributors) != 1 {
+					t.Errorf("unexpected work: %+v", w)
+				}
+			}
+			if requests != tt.requests {
+				t.Errorf("want %v requests, got %v", tt.requests, requests)
+			}
+		})
+	}
+}
+
+func Test_fetchMissingAuthors_doiResolver(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	crossrefSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/works" {
+			fmt.Fprint(w, `{"status":"ok","message-type":"work-list","message":{"total-results":0,"items":[]}}`)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer crossrefSrv.Close()
+
+	requests := 0
+	doiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/10.5281/zenodo.1234" || r.Header.Get("Accept") != doi.CSLJSON {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"type":"dataset","title":"Data","publisher":"Zenodo","issued":{"date-parts":[[2019]]},
+			"author":[{"given":"Jane","family":"Doe"},{"literal":"Soft Robotics Lab"}]}`)
+	}))
+	defer doiSrv.Close()
+
+	cref, err := crossref.New(crossrefSrv.URL, crossref.WithRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver, err := doi.New(doiSrv.URL, doi.WithRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &orcid.Work{Title: "Data", Type: "other", DoiURI: "https://doi.org/10.5281/zenodo.1234"}
+	missing := &orcid.Work{Title: "Missing", Type: "other", DoiURI: "https://doi.org/10.5281/missing"}
+	users := []*user{{Title: "User:Jane Doe", Works: []*orcid.Work{w, missing}}}
+
+	c := newTestCache(t)
+	if err = fetchMissingAuthors(context.Background(), cref, nil, resolver, c, logger, users); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Type != "data-set" || w.Year != 2019 || len(w.Contributors) != 2 ||
+		w.Contributors[0].FamilyName != "Doe" || w.Contributors[1].Name != "Soft Robotics Lab" {
+		t.Errorf("unexpected work: %+v", w)
+	}
+
+	// the missing DOI is cached after CSL-JSON and BibTeX are requested
+	if requests != 3 {
+		t.Errorf("want 3 requests, got %v", requests)
+	}
+	requests = 0
+	users = []*user{{Title: "User:Jane Doe", Works: []*orcid.Work{
+		{Title: "Missing", Type: "other", DoiURI: "https://doi.org/10.5281/missing"},
+	}}}
+	if err = fetchMissingAuthors(context.Background(), cref, nil, resolver, c, logger, users); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 0 {
+		t.Errorf("want no requests of the second run, got %v", requests)
+	}
+}
+
+func Test_fetchMissingAuthors_dataCite(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	crossrefSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/works" {
+			fmt.Fprint(w, `{"status":"ok","message-type":"work-list","message":{"total-results":0,"items":[]}}`)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer crossrefSrv.Close()
+
+	dataciteSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dois/10.5281/zenodo.1234" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"id":"10.5281/zenodo.1234","type":"dois","attributes":{
+			"creators":[{"name":"Doe, Jane","nameType":"Personal","givenName":"Jane","familyName":"Doe"}],
+			"titles":[{"title":"Soft Robot Controller"}],"publisher":"Zenodo","publicationYear":2020,
+			"types":{"resourceTypeGeneral":"Software"}}}}`)
+	}))
+	defer dataciteSrv.Close()
+
+	cref, err := crossref.New(crossrefSrv.URL, crossref.WithRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc, err := datacite.New(dataciteSrv.URL, datacite.WithRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &orcid.Work{Title: "Soft Robot Controller", DoiURI: "https://doi.org/10.5281/zenodo.1234"}
+	users := []*user{{Title: "User:Jane Doe", Works: []*orcid.Work{w}}}
+
+	if err = fetchMissingAuthors(context.Background(), cref, dc, nil, newTestCache(t), logger, users); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Type != "software" || w.Year != 2020 || w.JournalTitle != "Zenodo" || len(w.Contributors) != 1 ||
+		w.Contributors[0].Name != "Jane Doe" || w.Contributors[0].Sequence != "first" {
+		t.Errorf("unexpected work: %+v", w)
+	}
+}
+
+func Test_filterDuplicatedWorksByDOI_canonical(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	works := []*orcid.Work{
+		{Title: "A", ExternalIDs: []orcid.ExternalID{{Type: "doi", Value: "10.1/ABC"}}},
+		{Title: "A", ExternalIDs: []orcid.ExternalID{{Type: "doi", Value: "https://doi.org/10.1/abc"}}},
+		{Title: "A", ExternalIDs: []orcid.ExternalID{{Type: "doi", Value: "doi:10.1%2Fabc"}}},
+		{Title: "B", ExternalIDs: []orcid.ExternalID{{Type: "eid", Value: "2-s2.0-1"}}},
+		{Title: "C", DoiURI: "http://dx.doi.org/10.1/C"},
+	}
+
+	got, err := filterDuplicatedWorksByDOI(works, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] != works[0] || got[1] != works[3] || got[2] != works[4] {
+		t.Errorf("want works A, B and C, got %v", len(got))
+	}
+}
+
+func Test_dedupWorks(t *testing.T) {
+	paper := func() *orcid.Work {
+		return &orcid.Work{
+			Title:        "Soft Actuators: A Review",
+			Year:         2019,
+			JournalTitle: "Actuators",
+			Type:         "journal-article",
+			ExternalIDs:  []orcid.ExternalID{{Type: "doi", Value: "10.3390/ACT7010007"}},
+			Contributors: []*orcid.Contributor{{Name: "Jane Doe"}},
+		}
+	}
+	record := func() *orcid.Work {
+		return &orcid.Work{
+			Title:       "Soft actuators - a review",
+			Year:        2018,
+			Type:        "other",
+			ExternalIDs: []orcid.ExternalID{{Type: "eid", Value: "2-s2.0-85041"}},
+		}
+	}
+	preprint := func() *orcid.Work {
+		return &orcid.Work{
+			Title:       "Soft actuators - a review",
+			Year:        2018,
+			Type:        "other",
+			ExternalIDs: []orcid.ExternalID{{Type: "arxiv", Value: "arXiv:1801.00001v2"}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		works      []*orcid.Work
+		wantTitles []string
+		wantMerges int
+	}{
+		{
+			name:       "A",
+			works:      []*orcid.Work{record(), paper()},
+			wantTitles: []string{"Soft Actuators: A Review"},
+			wantMerges: 1,
+		},
+		{
+			name:       "F",
+			works:      []*orcid.Work{preprint(), paper()},
+			wantTitles: []string{"Soft actuators - a review", "Soft Actuators: A Review"},
+		},
+		{
+			name: "B",
+			works: []*orcid.Work{
+				{Title: "First", ExternalIDs: []orcid.ExternalID{{Type: "eid", Value: "2-s2.0-85041"}}},
+				{Title: "First work", ExternalIDs: []orcid.ExternalID{{Type: "eid", Value: "85041"}}},
+				{Title: "Other"},
+			},
+			wantTitles: []string{"First", "Other"},
+			wantMerges: 1,
+		},
+		{
+			name: "C",
+			works: []*orcid.Work{
+				paper(),
+				{Title: "Soft Actuators: A Review", Year: 2019, ExternalIDs: []orcid.ExternalID{{Type: "doi", Value: "10.1000/other"}}},
+			},
+			wantTitles: []string{"Soft Actuators: A Review", "Soft Actuators: A Review"},
+		},
+		{
+			name:       "D",
+			works:      []*orcid.Work{{Title: "Annual Report", Year: 2015}, {Title: "Annual Report", Year: 2019}},
+			wantTitles: []string{"Annual Report", "Annual Report"},
+		},
+		{
+			name: "E",
+			works: []*orcid.Work{
+				paper(),
+				{Title: "Soft Actuators: A Review", Year: 2019},
+				{Title: "Soft actuators, a review", Year: 2019, ExternalIDs: []orcid.ExternalID{{Type: "doi", Value: "10.1000/other"}}},
+			},
+			wantTitles: []string{"Soft Actuators: A Review", "Soft actuators, a review"},
+			wantMerges: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, merges := dedupWorks(tt.works)
+			titles := make([]string, len(got))
+			for i, w := range got {
+				titles[i] = string(w.Title)
+			}
+			if !reflect.DeepEqual(titles, tt.wantTitles) {
+				t.Errorf("dedupWorks() = %v, want %v", titles, tt.wantTitles)
+			}
+			if len(merges) != tt.wantMerges {
+				t.Errorf("want %v merges, got %v", tt.wantMerges, merges)
+			}
+		})
+	}
+
+	// the paper is kept and gets the Scopus id of the other record
+	got, merges := dedupWorks([]*orcid.Work{record(), paper()})
+	if len(got[0].ExternalIDs) != 2 || got[0].Type != "journal-article" || got[0].Year != 2019 {
+		t.Errorf("want the paper with both ids, got %+v", got[0])
+	}
+	if s := merges[0].String(); !strings.Contains(s, "title similarity") {
+		t.Errorf("want the reason in the report, got %s", s)
+	}
+}
+
+func Test_linkPreprints(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	// works are requested in a batch, not one by one
+	single := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/works" {
+			single++
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok","message-type":"work-list","message":{"total-results":1,"items":[{"DOI":"10.1000/journal",
+			"relation":{"has-preprint":[{"id-type":"doi","id":"10.1101/2019.01.01.000001","asserted-by":"object"}]}}]}}`)
+	}))
+	defer srv.Close()
+
+	cref, err := crossref.New(srv.URL, crossref.WithRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	works := []*orcid.Work{
+		{Title: "Bio preprint", Year: 2019, Type: "preprint", ExternalIDs: []orcid.ExternalID{{Type: "doi", Value: "10.1101/2019.01.01.000001"}}},
+		{Title: "Journal version", Year: 2020, Type: "journal-article", ExternalIDs: []orcid.ExternalID{{Type: "doi", Value: "10.1000/journal"}}},
+		{Title: "Soft Actuators: A Review", Year: 2019, Type: "journal-article", ExternalIDs: []orcid.ExternalID{{Type: "doi", Value: "10.3390/act7010007"}}},
+		{Title: "Soft actuators - a review", Year: 2018, Type: "other", ExternalIDs: []orcid.ExternalID{{Type: "arxiv", Value: "arXiv:1801.00001v2"}}},
+		{Title: "Shared id", Year: 2017, Type: "conference-paper", ExternalIDs: []orcid.ExternalID{{Type: "arxiv", Value: "1701.00001"}}},
+		{Title: "Shared id (preprint)", Year: 2016, ExternalIDs: []orcid.ExternalID{{Type: "doi", Value: "10.48550/arXiv.1701.00001"}}},
+		{Title: "Unrelated preprint", Year: 2019, Type: "preprint"},
+	}
+	users := []*user{{Title: "User:Jane Doe", Works: works}}
+
+	if err = linkPreprints(context.Background(), cref, newTestCache(t), users, logger); err != nil {
+		t.Fatal(err)
+	}
+
+	if single > 0 {
+		t.Errorf("want no single requests, got %v", single)
+	}
+
+	got := users[0].Works
+	if len(got) != 4 || got[0] != works[1] || got[1] != works[2] || got[2] != works[4] || got[3] != works[6] {
+		t.Fatalf("want the published works and the unrelated preprint, got %v works", len(got))
+	}
+	for i, want := range []*orcid.Work{works[0], works[3], works[5]} {
+		if len(got[i].Preprints) != 1 || got[i].Preprints[0] != want {
+			t.Errorf("want %q linked to %q, got %v", want.Title, got[i].Title, got[i].Preprints)
+		}
+	}
+
+	if link := preprintLink(works[3]); link != "[https://arxiv.org/abs/1801.00001v2 arXiv:1801.00001v2]" {
+		t.Errorf("unexpected arXiv link: %v", link)
+	}
+	if link := preprintLink(works[5]); link != "[https://arxiv.org/abs/1701.00001 arXiv:1701.00001]" {
+		t.Errorf("unexpected arXiv DOI link: %v", link)
+	}
+	if link := preprintLink(works[0]); link != "[https://doi.org/10.1101/2019.01.01.000001 doi:10.1101/2019.01.01.000001]" {
+		t.Errorf("unexpected DOI link: %v", link)
+	}
+}
+
+func Test_aggregateWorks(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	users := []*user{
+		{Title: "User:John Roe", Works: []*orcid.Work{
+			{Title: "Soft Actuators for Robots", Year: 2019, Type: "journal-article"},
+			{Title: "Only John's", Year: 2018, Type: "journal-article"},
+		}},
+		{Title: "User:Jane_Doe", Works: []*orcid.Work{
+			{
+				Title:        "Soft actuators for robots",
+				Year:         2019,
+				Type:         "journal-article",
+				JournalTitle: "Actuators",
+				Contributors: []*orcid.Contributor{{Name: "Jane Doe"}, {Name: "John Roe"}},
+				ExternalIDs:  []orcid.ExternalID{{Type: "eid", Value: "2-s2.0-1"}},
+			},
+		}},
+	}
+
+	works := aggregateWorks(users, logger)
+	if len(works) != 2 {
+		t.Fatalf("want 2 works, got %v", len(works))
+	}
+
+	w := works[0]
+	if w.JournalTitle != "Actuators" || len(w.Contributors) != 2 {
+		t.Errorf("want the richest metadata, got %+v", w)
+	}
+	if !reflect.DeepEqual(w.Members, []string{"Jane Doe", "John Roe"}) {
+		t.Errorf("want both members, got %v", w.Members)
+	}
+	if !reflect.DeepEqual(works[1].Members, []string{"John Roe"}) {
+		t.Errorf("want a single member, got %v", works[1].Members)
+	}
+	if len(users[0].Works) != 2 || users[0].Works[0].Members != nil || len(users[1].Works[0].ExternalIDs) != 1 {
+		t.Errorf("works of users must be left as they are")
+	}
+
+	markup, err := renderTmpl(groupByTypeAndYear(works, defaultTaxonomy, logger), "publications-by-year.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(markup, "(PIs: Jane Doe, John Roe)") != 1 || strings.Count(markup, "PIs:") != 1 {
+		t.Errorf("want a single badge of the co-authored work, got %s", markup)
+	}
+	if !strings.Contains(markup, "* J. Doe and J. Roe (2019)") {
+		t.Errorf("want authors in the IEEE style, got %s", markup)
+	}
+}
+
+func Test_readOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overrides")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		wantErr bool
+	}{
+		{
+			name: "A",
+			file: "overrides.yaml",
+			data: `
+0000-0002-0183-1282:
+  hide:
+    - put-code: 12345
+  override:
+    - doi: https://doi.org/10.1000/ABC
+      year: 2018
+      contributors: [Jane Doe, John Roe]
+  pin:
+    - title: Manual Work
+      type: book
+      doi: 10.1000/manual
+`,
+		},
+		{
+			name: "B",
+			file: "overrides.json",
+			data: `{"0000-0002-0183-1282": {"hide": [{"doi": "10.1000/abc"}]}}`,
+		},
+		{
+			name:    "C",
+			file:    "unknown-field.yaml",
+			data:    "0000-0002-0183-1282:\n  hidden:\n    - doi: 10.1000/abc\n",
+			wantErr: true,
+		},
+		{
+			name:    "D",
+			file:    "no-match.yaml",
+			data:    "0000-0002-0183-1282:\n  hide:\n    - title: Abstract\n",
+			wantErr: true,
+		},
+		{
+			name:    "E",
+			file:    "bad-doi.yaml",
+			data:    "0000-0002-0183-1282:\n  override:\n    - doi: abc\n      year: 2018\n",
+			wantErr: true,
+		},
+		{
+			name:    "F",
+			file:    "bad-id.json",
+			data:    `{"Jane Doe": {}}`,
+			wantErr: true,
+		},
+		{
+			name:    "G",
+			file:    "unknown-field.json",
+			data:    `{"0000-0002-0183-1282": {"hidden": [{"doi": "10.1000/abc"}]}}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := ioutil.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			o, err := readOverrides(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readOverrides() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && o["0000-0002-0183-1282"] == nil {
+				t.Errorf("want overrides of the user, got %+v", o)
+			}
+		})
+	}
+}
+
+func Test_overrides_apply(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	o := overrides{
+		"0000-0002-0183-1282": {
+			Hide: []workMatch{{PutCode: "2"}, {DOI: "doi:10.1000/Thesis"}},
+			Override: []workOverride{{
+				workMatch:  workMatch{DOI: "https://doi.org/10.1000/ABC"},
+				workFields: workFields{Year: 2018, Type: "journal-article", Contributors: []string{"Jane Doe"}},
+			}},
+			Pin: []pinnedWork{{workFields: workFields{Title: "Manual Work", Type: "book", Year: 2020}, DOI: "10.1000/manual"}},
+		},
+	}
+
+	u := &user{Title: "User:Jane Doe", OrcID: "0000-0002-0183-1282", Works: []*orcid.Work{
+		{Path: "/0000-0002-0183-1282/work/1", Title: "Paper", Year: 2019, Month: 5, Type: "other",
+			ExternalIDs: []orcid.ExternalID{{Type: "doi", Value: "10.1000/abc"}}},
+		{Path: "/0000-0002-0183-1282/work/2", Title: "Abstract"},
+		{Path: "/0000-0002-0183-1282/work/3", Title: "Thesis", ExternalIDs: []orcid.ExternalID{{Type: "doi", Value: "10.1000/thesis"}}},
+	}}
+	other := &user{Title: "User:John Roe", OrcID: "0000-0001-0000-0000", Works: []*orcid.Work{{Title: "Kept"}}}
+
+	for _, v := range []*user{u, other} {
+		o.apply(v, logger)
+		o.modifier(v.OrcID)(v.Works)
+	}
+
+	if len(u.Works) != 2 {
+		t.Fatalf("want the paper and the pinned work, got %v works", len(u.Works))
+	}
+	if w := u.Works[0]; w.Year != 2018 || w.Month != 0 || w.Type != "journal-article" || len(w.Contributors) != 1 || w.Title != "Paper" {
+		t.Errorf("want the overridden paper, got %+v", w)
+	}
+	if w := u.Works[1]; w.Title != "Manual Work" || w.Type != "book" || w.DoiURI != "https://doi.org/10.1000/manual" {
+		t.Errorf("want the pinned work, got %+v", w)
+	}
+	if len(other.Works) != 1 {
+		t.Errorf("works of other users must be left as they are")
+	}
+
+	// no overrides
+	var none overrides
+	none.apply(other, logger)
+	if len(other.Works) != 1 {
+		t.Errorf("works must be left as they are without overrides")
+	}
+}
+
+func Test_groupByTypeAndYear_taxonomy(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	tax := taxonomy{
+		{Title: "Books", Types: []string{"book", "book-chapter"}},
+		{Title: "Journal Articles", Types: []string{"journal-article"}},
+		{Types: []string{"lecture-speech"}, Hidden: true},
+		{Title: "Miscellaneous"},
+	}
+	if err := tax.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	works := []*orcid.Work{
+		{Title: "Paper", Year: 2019, Type: "journal-article"},
+		{Title: "Chapter", Year: 2018, Type: "book-chapter"},
+		{Title: "Book", Year: 2019, Type: "book"},
+		{Title: "Talk", Year: 2019, Type: "lecture-speech"},
+		{Title: "Data", Year: 2017, Type: "data-set"},
+	}
+
+	sections := groupByTypeAndYear(works, tax, logger)
+	titles := []string{}
+	for _, s := range sections {
+		titles = append(titles, s.Title)
+		for _, year := range s.Subgroups {
+			for _, w := range year.Works {
+				titles = append(titles, string(w.Title))
+			}
+		}
+	}
+	want := []string{"Books", "Book", "Chapter", "Journal Articles", "Paper", "Miscellaneous", "Data"}
+	if !reflect.DeepEqual(titles, want) {
+		t.Errorf("groupByTypeAndYear() = %v, want %v", titles, want)
+	}
+
+	markup, err := renderTmpl(sections, "publications-list.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMarkup := "\n=== Books ===\n\n==== 2019 ====\n\n* (2019) Book.\n\n==== 2018 ====\n\n* (2018) Chapter.\n" +
+		"\n=== Journal Articles ===\n\n==== 2019 ====\n\n* (2019) Paper.\n" +
+		"\n=== Miscellaneous ===\n\n==== 2017 ====\n\n* (2017) Data.\n"
+	if markup != wantMarkup {
+		t.Errorf("markup = %q, want %q", markup, wantMarkup)
+	}
+}
+
+func Test_publicationsList_emptySections(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	works := []*orcid.Work{{Title: "Data", Year: 2017, Type: "data-set"}}
+
+	tests := []struct {
+		name     string
+		grouping string
+		want     string
+	}{
+		{name: "A", grouping: "type", want: "\n=== Other ===\n\n* (2017) Data.\n"},
+		{name: "B", grouping: "type-year", want: "\n=== Other ===\n\n==== 2017 ====\n\n* (2017) Data.\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := newGrouper(tt.grouping, defaultTaxonomy, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			markup, err := renderTmpl(g.Group(works), "publications-list.tmpl")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if markup != tt.want {
+				t.Errorf("markup = %q, want %q", markup, tt.want)
+			}
+		})
+	}
+}
+
+func Test_taxonomy_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tax     taxonomy
+		wantErr bool
+	}{
+		{name: "A", tax: defaultTaxonomy},
+		{name: "B", tax: taxonomy{}, wantErr: true},
+		{name: "C", tax: taxonomy{{Title: "A"}, {Title: "B"}}, wantErr: true},
+		{name: "D", tax: taxonomy{{Title: "A", Types: []string{"book"}}, {Title: "B", Types: []string{"book"}}}, wantErr: true},
+		{name: "E", tax: taxonomy{{Types: []string{"book"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.tax.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_newGrouper(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	tax := taxonomy{
+		{Title: "Journal Articles", Types: []string{"journal-article"}},
+		{Title: "Conference Papers", Types: []string{"conference-paper"}},
+		{Types: []string{"lecture-speech"}, Hidden: true},
+		{Title: "Other"},
+	}
+
+	works := []*orcid.Work{
+		{Title: "A", Year: 2017, Type: "journal-article", JournalTitle: "Sensors", Members: []string{"John Roe"}},
+		{Title: "B", Year: 2019, Type: "conference-paper", Members: []string{"Jane Doe", "John Roe"}},
+		{Title: "C", Year: 2019, Type: "journal-article", JournalTitle: "actuators", Members: []string{"Jane Doe"}},
+		{Title: "D", Year: 2018, Type: "journal-article", JournalTitle: "sensors"},
+		{Title: "E", Year: 2019, Type: "lecture-speech", JournalTitle: "Sensors", Members: []string{"Jane Doe"}},
+	}
+
+	// outline lists titles of groups and works, titles of subgroups are
+	// prefixed with "> "
+	outline := func(groups []*workGroup) []string {
+		lines := []string{}
+		for _, g := range groups {
+			lines = append(lines, g.Title)
+			for _, w := range g.Works {
+				lines = append(lines, string(w.Title))
+			}
+			for _, sg := range g.Subgroups {
+				lines = append(lines, "> "+sg.Title)
+				for _, w := range sg.Works {
+					lines = append(lines, string(w.Title))
+				}
+			}
+		}
+		return lines
+	}
+
+	tests := []struct {
+		name     string
+		grouping string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "A", grouping: "type-year", want: []string{"Journal Articles", "> 2019", "C", "> 2018", "D", "> 2017", "A", "Conference Papers", "> 2019", "B", "Other"}},
+		{name: "B", grouping: "year-type", want: []string{"2019", "> Journal Articles", "C", "> Conference Papers", "B", "2018", "> Journal Articles", "D", "2017", "> Journal Articles", "A"}},
+		{name: "C", grouping: "type", want: []string{"Journal Articles", "C", "D", "A", "Conference Papers", "B", "Other"}},
+		{name: "D", grouping: "year", want: []string{"2019", "B", "C", "2018", "D", "2017", "A"}},
+		{name: "E", grouping: "venue", want: []string{"actuators", "C", "Sensors", "D", "A", "Other", "B"}},
+		{name: "F", grouping: "pi", want: []string{"Jane Doe", "B", "C", "John Roe", "B", "A", "", "D"}},
+		{name: "G", grouping: "flat", want: []string{"", "B", "C", "D", "A"}},
+		{name: "H", grouping: "by-color", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := newGrouper(tt.grouping, tax, logger)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newGrouper() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := outline(g.Group(works)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Group() = %q, want %q", got, tt.want)
+			}
+			for _, tmpl := range []string{"publications-list.tmpl", "publications-by-year.tmpl"} {
+				if _, err := renderTmpl(g.Group(works), tmpl); err != nil {
+					t.Errorf("renderTmpl(%s) error = %v", tmpl, err)
+				}
+			}
+		})
+	}
+}
+
+func Test_readJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		want    []job
+		wantErr bool
+	}{
+		{
+			name: "A",
+			file: "jobs.yaml",
+			data: `
+- name: profiles
+  category: Staff
+  section: Publications
+- name: lab
+  users: [User:Jane_Doe, User:John_Roe]
+  page: Lab_Publications
+  section: Publications
+  grouping: flat
+  filter:
+    last-years: 5
+    types: [journal-article]
+  purge: [Lab]
+`,
+			want: []job{
+				{Name: "profiles", Category: "Staff", Section: "Publications", Template: "publications-list.tmpl", Grouping: "type"},
+				{
+					Name: "lab", Users: []string{"User:Jane_Doe", "User:John_Roe"}, Page: "Lab_Publications", Section: "Publications",
+					Template: "publications-by-year.tmpl", Grouping: "flat",
+					Filter: workFilter{LastYears: 5, Types: []string{"journal-article"}}, Purge: []string{"Lab"},
+				},
+			},
+		},
+		{
+			name: "B",
+			file: "jobs.json",
+			data: `[{"name": "PIs", "category": "PI", "page": "PIs", "section": "Publications", "template": "venues.tmpl", "grouping": "venue"}]`,
+			want: []job{{Name: "PIs", Category: "PI", Page: "PIs", Section: "Publications", Template: "venues.tmpl", Grouping: "venue"}},
+		},
+		{
+			name:    "C",
+			file:    "unknown-field.yaml",
+			data:    "- name: profiles\n  section: Publications\n  target: Lab\n",
+			wantErr: true,
+		},
+		{
+			name:    "D",
+			file:    "no-section.yaml",
+			data:    "- name: profiles\n",
+			wantErr: true,
+		},
+		{
+			name:    "E",
+			file:    "bad-grouping.yaml",
+			data:    "- name: profiles\n  section: Publications\n  grouping: by-color\n",
+			wantErr: true,
+		},
+		{
+			name:    "F",
+			file:    "twice.yaml",
+			data:    "- name: profiles\n  section: Publications\n- name: profiles\n  section: Publications\n",
+			wantErr: true,
+		},
+		{
+			name:    "G",
+			file:    "no-years.yaml",
+			data:    "- name: profiles\n  section: Publications\n  filter:\n    from-year: 2020\n    to-year: 2019\n",
+			wantErr: true,
+		},
+		{
+			name:    "H",
+			file:    "empty.yaml",
+			data:    "",
+			wantErr: true,
+		},
+		{
+			name:    "I",
+			file:    "unknown-field.json",
+			data:    `[{"name": "profiles", "section": "Publications", "target": "Lab"}]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := ioutil.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readJobs(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readJobs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readJobs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_workFilter_apply(t *testing.T) {
+	works := []*orcid.Work{
+		{Title: "A", Year: 2020, Type: "journal-article"},
+		{Title: "B", Year: 2016, Type: "journal-article"},
+		{Title: "C", Year: 2019, Type: "book"},
+		{Title: "D", Type: "journal-article"},
+	}
+
+	tests := []struct {
+		name   string
+		filter workFilter
+		want   []string
+	}{
+		{name: "A", filter: workFilter{}, want: []string{"A", "B", "C", "D"}},
+		{name: "B", filter: workFilter{LastYears: 2}, want: []string{"A", "C"}},
+		{name: "C", filter: workFilter{FromYear: 2016, ToYear: 2019}, want: []string{"B", "C"}},
+		{name: "D", filter: workFilter{Types: []string{"journal-article"}}, want: []string{"A", "B", "D"}},
+		{name: "E", filter: workFilter{LastYears: 5, FromYear: 2019, Types: []string{"journal-article"}}, want: []string{"A"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, w := range tt.filter.apply(works, 2020) {
+				got = append(got, string(w.Title))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("apply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// recordingPublisher keeps the markup of updated sections and purged
+// pages.
+type recordingPublisher struct {
+	sections map[string]string
+	purged   []string
+}
+
+func (p *recordingPublisher) UpdateSection(pageTitle, sectionTitle, markup string) error {
+	p.sections[pageTitle+"#"+sectionTitle] = markup
+	return nil
+}
+
+func (p *recordingPublisher) Purge(pageTitles ...string) error {
+	p.purged = append(p.purged, pageTitles...)
+	return nil
+}
+
+func Test_publishJob(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	newUsers := func() []*user {
+		return []*user{
+			{Title: "User:Jane_Doe", Works: []*orcid.Work{
+				{Title: "Recent Paper", Year: 2020, Type: "journal-article"},
+				{Title: "Old Paper", Year: 2010, Type: "journal-article"},
+			}},
+			{Title: "User:John_Roe", Works: []*orcid.Work{
+				{Title: "Recent Book", Year: 2019, Type: "book"},
+			}},
+		}
+	}
+
+	for _, j := range defaultJobs("", "Publications", "type", "type-year", "", "") {
+		pub := &recordingPublisher{sections: map[string]string{}}
+		g, err := newGrouper(j.Grouping, defaultTaxonomy, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = publishJob(pub, j, newUsers(), g, 2020, logger); err != nil {
+			t.Fatal(err)
+		}
+		if len(j.Page) == 0 && len(pub.sections) != 2 {
+			t.Errorf("%s: want profile pages of both users, got %v", j.Name, pub.sections)
+		}
+		if len(j.Page) > 0 && (len(pub.sections) != 1 || !reflect.DeepEqual(pub.purged, []string{"Publications"})) {
+			t.Errorf("%s: want the single page and the purge, got %v and %v", j.Name, pub.sections, pub.purged)
+		}
+	}
+
+	j := job{
+		Name: "recent", Page: "Recent_Publications", Section: "Publications", Template: "publications-by-year.tmpl",
+		Grouping: "flat", Filter: workFilter{LastYears: 5},
+	}
+	pub := &recordingPublisher{sections: map[string]string{}}
+	g, err := newGrouper(j.Grouping, defaultTaxonomy, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := newUsers()
+	if err = publishJob(pub, j, users, g, 2020, logger); err != nil {
+		t.Fatal(err)
+	}
+	markup := pub.sections["Recent_Publications#Publications"]
+	if !strings.Contains(markup, "Recent Paper") || !strings.Contains(markup, "Recent Book") || strings.Contains(markup, "Old Paper") {
+		t.Errorf("want recent works only, got %s", markup)
+	}
+	if len(users[0].Works) != 2 {
+		t.Errorf("works of users must be left as they are for other jobs")
+	}
+	if len(pub.purged) != 0 {
+		t.Errorf("want no purge, got %v", pub.purged)
+	}
+}
+
+func Test_checkTemplate(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"titles.tmpl":       "{{range .}}=== {{.Title}} ===\n{{range .Works}}* {{.Title}}\n{{end}}{{end}}",
+		"bad-syntax.tmpl":   "{{range .}}=== {{.Title}} ===",
+		"bad-field.tmpl":    "{{range .}}{{range .Years}}{{end}}{{end}}",
+		"bad-function.tmpl": "{{range .}}{{range .Works}}{{stripPrefix .Title}}{{end}}{{end}}",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		grouping string
+		wantErr  bool
+	}{
+		{name: "A", path: "publications-list.tmpl", grouping: "type"},
+		{name: "B", path: "publications-by-year.tmpl", grouping: "type-year"},
+		{name: "C", path: "publications-by-year.tmpl", grouping: "pi"},
+		{name: "D", path: filepath.Join(dir, "titles.tmpl"), grouping: "venue"},
+		{name: "E", path: filepath.Join(dir, "bad-syntax.tmpl"), grouping: "type", wantErr: true},
+		{name: "F", path: filepath.Join(dir, "bad-field.tmpl"), grouping: "type", wantErr: true},
+		{name: "G", path: filepath.Join(dir, "bad-function.tmpl"), grouping: "flat", wantErr: true},
+		{name: "H", path: filepath.Join(dir, "missing.tmpl"), grouping: "type", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := newGrouper(tt.grouping, defaultTaxonomy, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := checkTemplate(tt.path, g); (err != nil) != tt.wantErr {
+				t.Errorf("checkTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// the built-in templates don't depend on the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	markup, err := renderTmpl(groupByTypeAndYear(sampleWorks(), defaultTaxonomy, logger), "publications-by-year.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(markup, "=== Journal Articles ===") || !strings.Contains(markup, "(PIs: Jane Doe, John Roe)") {
+		t.Errorf("unexpected markup: %s", markup)
+	}
+
+	// a file with the name of a built-in template doesn't replace it
+	if err = ioutil.WriteFile("publications-list.tmpl", []byte(files["titles.tmpl"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	markup, err = renderTmpl(groupByType(sampleWorks(), defaultTaxonomy), "publications-list.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(markup, "2019") {
+		t.Errorf("want the built-in template, got %s", markup)
+	}
+
+	jobs := defaultJobs("", "Publications", "type", "type-year", "", filepath.Join(dir, "bad-field.tmpl"))
+	if err = checkTemplates(jobs, defaultTaxonomy, logger); err == nil {
+		t.Errorf("want an error of the broken template of the aggregate page")
+	}
+}
+
+func Test_dedupCandidates(t *testing.T) {
+	works := []*orcid.Work{
+		{Title: "A", Year: 2019, ExternalIDs: []orcid.ExternalID{{Type: "eid", Value: "2-s2.0-1"}}},
+		{Title: "B", Year: 2010, ExternalIDs: []orcid.ExternalID{{Type: "eid", Value: "1"}}},
+		{Title: "C", Year: 2020},
+		{Title: "D", Year: 2015},
+		{Title: "E"},
+		{Title: "F", Year: 2018},
+	}
+	infos := make([]dedupInfo, len(works))
+	byKey := map[string][]int{}
+	byYear := map[int][]int{}
+	for i, w := range works {
+		infos[i] = newDedupInfo(w)
+		for _, k := range infos[i].keys {
+			byKey[k] = append(byKey[k], i)
+		}
+		byYear[w.Year] = append(byYear[w.Year], i)
+	}
+
+	tests := []struct {
+		name string
+		i    int
+		want []int
+	}{
+		{name: "A", i: 0, want: []int{1, 2, 4, 5}},
+		{name: "B", i: 3, want: []int{4}},
+		{name: "C", i: 4, want: []int{5}},
+		{name: "D", i: 5, want: []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dedupCandidates(tt.i, infos[tt.i], byKey, byYear, len(works)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dedupCandidates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_fetchMissingAuthors_dataCiteUnknownOnly(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	// CrossRef knows the first DOI, but not its journal title
+	crossrefSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/works" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok","message-type":"work-list","message":{"total-results":1,"items":[
+			{"DOI":"10.1000/a","author":[{"given":"Jane","family":"Doe"}]}]}}`)
+	}))
+	defer crossrefSrv.Close()
+
+	requests := 0
+	dataciteSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer dataciteSrv.Close()
+
+	cref, err := crossref.New(crossrefSrv.URL, crossref.WithRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc, err := datacite.New(dataciteSrv.URL, datacite.WithRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		doi   string
+		cache *cache.Cache
+		// requests are the amount of DataCite requests of two runs
+		requests int
+	}{
+		// DOIs known to CrossRef aren't looked up in DataCite
+		{name: "A", doi: "10.1000/a", cache: newTestCache(t), requests: 0},
+		// DOIs unknown to DataCite are cached as missing
+		{name: "B", doi: "10.1000/unknown", cache: newTestCache(t), requests: 1},
+		{name: "C", doi: "10.1000/unknown", requests: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			for run := 0; run < 2; run++ {
+				users := []*user{{Title: "User:Jane Doe", Works: []*orcid.Work{
+					{Title: "A", Year: 2019, Type: "journal-article", ExternalIDs: []orcid.ExternalID{{Type: "doi", Value: tt.doi}}},
+				}}}
+				if err := fetchMissingAuthors(context.Background(), cref, dc, nil, tt.cache, logger, users); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if requests != tt.requests {
+				t.Errorf("want %v requests, got %v", tt.requests, requests)
+			}
+		})
+	}
+}
+
+func Test_jobRunner_completeWorks_overrides(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var items string
+		if r.URL.Query().Get("query.bibliographic") == "Soft Actuators 2018" || strings.Contains(r.URL.Query().Get("filter"), "10.1000/soft") {
+			items = `{"DOI":"10.1000/soft","type":"journal-article","container-title":["Actuators"],"title":["Soft actuators"],
+				"issued":{"date-parts":[[2018]]},"author":[{"given":"Jane","family":"Doe"}]}`
+		}
+		fmt.Fprintf(w, `{"status":"ok","message-type":"work-list","message":{"items":[%s]}}`, items)
+	}))
+	defer srv.Close()
+
+	cref, err := crossref.New(srv.URL, crossref.WithRetries(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// works are read from the cache
+	c := newTestCache(t)
+	u := &user{Title: "User:Jane Doe", OrcID: "0000-0002-0183-1282", Works: []*orcid.Work{
+		{Title: "Soft Actuators", Year: 2018},
+	}}
+	if err = dumpUserWorksXML(c, u); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &jobRunner{
+		crossref:          cref,
+		cache:             c,
+		doiSearch:         true,
+		doiMatchThreshold: 0.85,
+		overrides: overrides{"0000-0002-0183-1282": {
+			Override: []workOverride{{workMatch: workMatch{DOI: "10.1000/soft"}, workFields: workFields{Title: "Soft Actuators for Robots", Type: "other"}}},
+		}},
+		logger: logger,
+	}
+	users := []*user{{Title: u.Title, OrcID: u.OrcID}}
+	if err = r.completeWorks(context.Background(), users); err != nil {
+		t.Fatal(err)
+	}
+
+	// the override matches the recovered DOI and its type isn't
+	// replaced by the CrossRef one
+	if len(users[0].Works) != 1 {
+		t.Fatalf("want 1 work, got %+v", users[0].Works)
+	}
+	if w := users[0].Works[0]; w.Title != "Soft Actuators for Robots" || w.Type != "other" || w.JournalTitle != "Actuators" {
+		t.Errorf("want the override applied to the completed work, got %+v", w)
+	}
+}
+
+func Test_readTaxonomy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sections")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		wantErr bool
+	}{
+		{name: "A", file: "sections.yaml", data: "- title: Books\n  types: [book]\n- title: Other\n"},
+		{name: "B", file: "sections.json", data: `[{"title": "Books", "types": ["book"]}, {"title": "Other"}]`},
+		{name: "C", file: "unknown-field.yaml", data: "- title: Books\n  kinds: [book]\n", wantErr: true},
+		{name: "D", file: "unknown-field.json", data: `[{"title": "Books", "kinds": ["book"]}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := ioutil.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readTaxonomy(path); (err != nil) != tt.wantErr {
+				t.Errorf("readTaxonomy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"html/template"
 	"log"
@@ -10,7 +9,6 @@ import (
 	"strings"
 	"sync"
 
-	"bitbucket.org/iharsuvorau/ims-publications/crossref"
 	"bitbucket.org/iharsuvorau/ims-publications/orcid"
 	"bitbucket.org/iharsuvorau/mediawiki"
 	"github.com/pkg/errors"
@@ -21,6 +19,9 @@ var tmplFuncs = map[string]interface{}{
 	"stripPrefix":    stripPrefix,
 	"stripPrefixURL": stripPrefixURL,
 	"unescape":       unescape,
+	"citeAuthors":    citeAuthors,
+	"preprintLink":   preprintLink,
+	"join":           strings.Join,
 }
 
 // user is a MediaWiki user with registries which handle publications.
@@ -30,6 +31,12 @@ type user struct {
 	Works []*orcid.Work
 }
 
+// name returns the name of the user shown on pages, e.g. Jane Doe of
+// User:Jane_Doe.
+func (u *user) name() string {
+	return strings.ReplaceAll(strings.TrimPrefix(u.Title, "User:"), "_", " ")
+}
+
 // exploreUsers gets users who belong to the category and fetches their
 // publication IDs and creates corresponding registries. If the category is
 // empty, all users are returned.
@@ -52,6 +59,12 @@ func exploreUsers(mwURI, category string, logger *log.Logger) ([]*user, error) {
 		return nil, err
 	}
 
+	return exploreUserPages(mwURI, userTitles, logger)
+}
+
+// exploreUserPages fetches ORCID iDs from external links of the user
+// pages, users without an ORCID iD are skipped.
+func exploreUserPages(mwURI string, userTitles []string, logger *log.Logger) ([]*user, error) {
 	users := []*user{}
 	var mut sync.Mutex
 	var limit = 20
@@ -112,30 +125,23 @@ func exploreUsers(mwURI, category string, logger *log.Logger) ([]*user, error) {
 		}
 	}
 
-	return users, err
+	return users, nil
 }
 
-// updateProfilePagesWithWorks fetches works for each user, updates personal pages and
-// purges cache for the aggregate Publications page.
-func updateProfilePagesWithWorks(mwURI, lgName, lgPass, sectionTitle string, users []*user, logger *log.Logger) error {
+// updateProfilePagesWithWorks renders works of each user with the template
+// and updates the section of the user's profile page.
+func updateProfilePagesWithWorks(pub publisher, sectionTitle, tmpl string, users []*user, g grouper, logger *log.Logger) error {
 	if len(users) == 0 {
 		return nil
 	}
 
-	const (
-		tmpl         = "publications-list.tmpl" // TODO: should be passed by a user
-		contentModel = "wikitext"
-	)
-
 	for _, u := range users {
-		byTypeAndYear := groupByTypeAndYear(u.Works, logger)
-
-		markup, err := renderTmpl(byTypeAndYear, tmpl)
+		markup, err := renderTmpl(g.Group(u.Works), tmpl)
 		if err != nil {
 			return err
 		}
 
-		_, err = mediawiki.UpdatePage(mwURI, u.Title, markup, contentModel, lgName, lgPass, sectionTitle)
+		err = pub.UpdateSection(u.Title, sectionTitle, markup)
 		if err != nil {
 			logger.Printf("profile page update failed for %s with error: %v", u.Title, err)
 			err = nil
@@ -148,43 +154,27 @@ func updateProfilePagesWithWorks(mwURI, lgName, lgPass, sectionTitle string, use
 	return nil
 }
 
-func updatePublicationsByYearWithWorks(mwURI, lgName, lgPass string, users []*user, logger *log.Logger, cref *crossref.Client) error {
+// updatePageWithWorks renders works of all users with the template and
+// updates the section of the page. Co-authored works are merged, so they
+// are listed once.
+func updatePageWithWorks(pub publisher, pageTitle, sectionTitle, tmpl string, users []*user, g grouper, logger *log.Logger) error {
 	if len(users) == 0 {
 		return nil
 	}
 
-	const (
-		tmpl         = "publications-by-year.tmpl" // TODO: should be passed by a user
-		pageTitle    = "PI_Publications_By_Year"
-		contentModel = "wikitext"
-		sectionTitle = "Publications By Year"
-	)
-
-	var works = []*orcid.Work{}
-	for _, u := range users {
-		works = append(works, u.Works...)
-	}
-
-	byTypeAndYear := groupByTypeAndYear(works, logger)
+	works := aggregateWorks(users, logger)
 
-	markup, err := renderTmpl(byTypeAndYear, tmpl)
+	markup, err := renderTmpl(g.Group(works), tmpl)
 	if err != nil {
 		return err
 	}
-	_, err = mediawiki.UpdatePage(mwURI, pageTitle, markup, contentModel, lgName, lgPass, sectionTitle)
+	err = pub.UpdateSection(pageTitle, sectionTitle, markup)
 	if err != nil {
 		return err
 	}
 
 	logger.Printf("%s page has been updated", pageTitle)
-	return mediawiki.Purge(mwURI, "Publications")
-}
-
-func renderTmpl(data interface{}, tmplPath string) (string, error) {
-	var tmpl = template.Must(template.New("").Funcs(tmplFuncs).ParseFiles(tmplPath))
-	var out bytes.Buffer
-	err := tmpl.ExecuteTemplate(&out, tmplPath, data)
-	return out.String(), err
+	return nil
 }
 
 func getYearsSorted(works []*orcid.Work) []int {
@@ -205,68 +195,6 @@ func getYearsSorted(works []*orcid.Work) []int {
 	return yearsSorted
 }
 
-func groupByTypeAndYear(works []*orcid.Work, logger *log.Logger) map[string][][]*orcid.Work {
-	// grouping by work type
-	byType := make(map[string][]*orcid.Work)
-	const (
-		t1 = "Journal Articles"
-		t2 = "Conference Papers"
-		t3 = "Other"
-	)
-	byType[t1] = []*orcid.Work{}
-	byType[t2] = []*orcid.Work{}
-	byType[t3] = []*orcid.Work{}
-	for _, w := range works {
-		switch w.Type {
-		case "journal-article":
-			byType[t1] = append(byType[t1], w)
-			continue
-		case "conference-paper":
-			byType[t2] = append(byType[t2], w)
-			continue
-		default:
-			byType[t3] = append(byType[t3], w)
-		}
-	}
-
-	// grouping each type group by year
-	byTypeAndYear := make(map[string][][]*orcid.Work)
-	for k, group := range byType {
-		years := getYearsSorted(group)
-
-		if byTypeAndYear[k] == nil {
-			byTypeAndYear[k] = make([][]*orcid.Work, len(years))
-		}
-
-		for i, year := range years {
-			if byTypeAndYear[k][i] == nil {
-				byTypeAndYear[k][i] = []*orcid.Work{}
-			}
-
-			for _, w := range group {
-				if w.Year == year {
-					byTypeAndYear[k][i] = append(byTypeAndYear[k][i], w)
-				}
-			}
-		}
-
-	}
-
-	// removing duplicates
-	for t := range byTypeAndYear {
-		for i := range byTypeAndYear[t] {
-			works, err := filterDuplicatedWorksByDOI(byTypeAndYear[t][i], logger)
-			if err != nil {
-				logger.Println(err)
-				continue
-			}
-			byTypeAndYear[t][i] = works
-		}
-	}
-
-	return byTypeAndYear
-}
-
 func stripPrefix(s, prefix string) string {
 	return strings.TrimPrefix(s, prefix)
 }
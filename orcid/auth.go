@@ -0,0 +1,127 @@
+package orcid
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithCredentials makes the client authenticate with the OAuth client
+// credentials of an ORCID member or a public API client. The token with
+// the /read-public scope is requested on the first request and reused
+// until it expires.
+func WithCredentials(clientID, clientSecret string) Option {
+	return func(c *Client) {
+		if c.auth == nil {
+			c.auth = &authenticator{}
+		}
+		c.auth.clientID = clientID
+		c.auth.clientSecret = clientSecret
+	}
+}
+
+// WithTokenURL sets the OAuth token endpoint. By default, it's derived
+// from the API base URL, e.g. https://orcid.org/oauth/token for
+// https://pub.orcid.org or https://api.orcid.org.
+func WithTokenURL(tokenURL string) Option {
+	return func(c *Client) {
+		if c.auth == nil {
+			c.auth = &authenticator{}
+		}
+		c.auth.tokenURL = tokenURL
+	}
+}
+
+// tokenScope is the scope needed to read public data.
+const tokenScope = "/read-public"
+
+// tokenLeeway is the time before the expiration when a token is
+// considered expired already.
+const tokenLeeway = time.Minute
+
+// authenticator acquires and caches access tokens.
+type authenticator struct {
+	clientID     string
+	clientSecret string
+	tokenURL     string
+
+	mu          sync.Mutex
+	accessToken string
+	expires     time.Time
+}
+
+// token returns the cached access token or requests a new one if it's
+// missing, expired or rejected by the API. The lock is held during the
+// request, so concurrent requests rejected with the same token wait for
+// a single renewal and reuse its token.
+func (a *authenticator) token(ctx context.Context, hc *http.Client, rejected string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	valid := len(a.accessToken) > 0 && time.Now().Add(tokenLeeway).Before(a.expires)
+	if valid && a.accessToken != rejected {
+		return a.accessToken, nil
+	}
+
+	v := url.Values{}
+	v.Set("client_id", a.clientID)
+	v.Set("client_secret", a.clientSecret)
+	v.Set("grant_type", "client_credentials")
+	v.Set("scope", tokenScope)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.tokenURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respData, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("token request failed, code %v, request URL: %v, response: %s",
+			resp.StatusCode, a.tokenURL, respData)
+	}
+
+	data := struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+		Scope       string `json:"scope"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", fmt.Errorf("failed to decode the token response: %v", err)
+	}
+	if len(data.AccessToken) == 0 {
+		return "", fmt.Errorf("token response has no access token")
+	}
+	if !strings.EqualFold(data.TokenType, "bearer") {
+		return "", fmt.Errorf("unsupported token type: %s", data.TokenType)
+	}
+
+	a.accessToken = data.AccessToken
+	a.expires = time.Now().Add(time.Duration(data.ExpiresIn) * time.Second)
+
+	return a.accessToken, nil
+}
+
+// defaultTokenURL derives the token endpoint from the API base URL by
+// removing the pub. or api. subdomain.
+func defaultTokenURL(apiBase *url.URL) string {
+	host := apiBase.Host
+	for _, prefix := range []string{"pub.", "api."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	return (&url.URL{Scheme: apiBase.Scheme, Host: host, Path: "/oauth/token"}).String()
+}
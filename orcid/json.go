@@ -0,0 +1,180 @@
+package orcid
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jsonValue is a JSON object which wraps a string value, e.g.
+// {"value": "2018"}.
+type jsonValue struct {
+	Value string `json:"value"`
+}
+
+// jsonDate is a JSON object with a timestamp in milliseconds.
+type jsonDate struct {
+	Value int64 `json:"value"`
+}
+
+func (d jsonDate) time() time.Time {
+	if d.Value == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, d.Value*int64(time.Millisecond)).UTC()
+}
+
+// jsonWorks is the works JSON object, it's the same in both versions.
+type jsonWorks struct {
+	Groups []struct {
+		Summaries []jsonWork `json:"work-summary"`
+	} `json:"group"`
+}
+
+// jsonWork is the work and work-summary JSON objects. Missing or null
+// fields are left zero.
+type jsonWork struct {
+	Path         string      `json:"path"`
+	DisplayIndex json.Number `json:"display-index"`
+	Created      jsonDate    `json:"created-date"`
+	Modified     jsonDate    `json:"last-modified-date"`
+	Source       struct {
+		SourceName jsonValue `json:"source-name"`
+	} `json:"source"`
+	Title struct {
+		Title jsonValue `json:"title"`
+	} `json:"title"`
+	JournalTitle jsonValue `json:"journal-title"`
+	Citation     struct {
+		Type  string `json:"citation-type"`
+		Value string `json:"citation-value"`
+	} `json:"citation"`
+	Type            string `json:"type"`
+	PublicationDate struct {
+		Year  jsonValue `json:"year"`
+		Month jsonValue `json:"month"`
+		Day   jsonValue `json:"day"`
+	} `json:"publication-date"`
+	ExternalIDs struct {
+		ExternalID []struct {
+			Type  string    `json:"external-id-type"`
+			Value string    `json:"external-id-value"`
+			URL   jsonValue `json:"external-id-url"`
+		} `json:"external-id"`
+	} `json:"external-ids"`
+	URL          jsonValue `json:"url"`
+	Contributors struct {
+		Contributor []struct {
+			CreditName jsonValue `json:"credit-name"`
+			ORCID      struct {
+				Path string `json:"path"`
+			} `json:"contributor-orcid"`
+			Attributes struct {
+				Sequence string `json:"contributor-sequence"`
+				Role     string `json:"contributor-role"`
+			} `json:"contributor-attributes"`
+		} `json:"contributor"`
+	} `json:"contributors"`
+}
+
+// jsonDecoder decodes JSON responses of both versions. Enumerations are
+// upper-case with underscores in v2.1, e.g. JOURNAL_ARTICLE, and
+// lower-case with dashes in v3.0 and in XML, so they are normalized to
+// the latter.
+type jsonDecoder struct {
+	version Version
+}
+
+func (d jsonDecoder) decodeSummaries(r io.Reader) (*[]Work, error) {
+	data := jsonWorks{}
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	works := []Work{}
+	for _, g := range data.Groups {
+		if len(g.Summaries) == 0 {
+			continue
+		}
+
+		// only the preferred summary of a group is taken like in XML
+		preferred := g.Summaries[0]
+		for _, s := range g.Summaries[1:] {
+			if s.displayIndex() > preferred.displayIndex() {
+				preferred = s
+			}
+		}
+		works = append(works, *preferred.work())
+	}
+
+	return &works, nil
+}
+
+func (d jsonDecoder) decodeWork(r io.Reader) (*Work, error) {
+	data := jsonWork{}
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, err
+	}
+	return data.work(), nil
+}
+
+func (v jsonWork) displayIndex() int64 {
+	i, _ := v.DisplayIndex.Int64()
+	return i
+}
+
+func (v jsonWork) work() *Work {
+	w := Work{
+		Created:      v.Created.time(),
+		Modified:     v.Modified.time(),
+		SourceName:   v.Source.SourceName.Value,
+		Year:         atoi(v.PublicationDate.Year.Value),
+		Month:        atoi(v.PublicationDate.Month.Value),
+		Day:          atoi(v.PublicationDate.Day.Value),
+		Path:         v.Path,
+		Title:        template.HTML(v.Title.Title.Value),
+		JournalTitle: v.JournalTitle.Value,
+		Type:         jsonEnum(v.Type),
+		URI:          v.URL.Value,
+	}
+
+	if len(v.Citation.Type) > 0 || len(v.Citation.Value) > 0 {
+		w.Citation = &Citation{Type: jsonEnum(v.Citation.Type), Value: v.Citation.Value}
+	}
+
+	for _, id := range v.ExternalIDs.ExternalID {
+		w.ExternalIDs = append(w.ExternalIDs, ExternalID{
+			Type:  jsonEnum(id.Type),
+			Value: id.Value,
+			URL:   template.HTML(id.URL.Value),
+		})
+	}
+
+	for _, c := range v.Contributors.Contributor {
+		w.Contributors = append(w.Contributors, &Contributor{
+			Name:     c.CreditName.Value,
+			ORCID:    ID(c.ORCID.Path),
+			Sequence: jsonEnum(c.Attributes.Sequence),
+			Role:     contributorRole(jsonEnum(c.Attributes.Role)),
+		})
+	}
+
+	return &w
+}
+
+// jsonEnum normalizes an enumeration value, CRediT role URIs are left
+// as they are.
+func jsonEnum(s string) string {
+	if strings.Contains(s, "/") {
+		return s
+	}
+	return strings.ToLower(strings.ReplaceAll(s, "_", "-"))
+}
+
+func atoi(s string) int {
+	i, _ := strconv.Atoi(s)
+	return i
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/url"
 	"strings"
+
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
 )
 
 func unescape(s string) string {
@@ -24,10 +26,15 @@ func UpdateExternalIDsURL(works []*Work) {
 			uri = ""
 			switch id.Type {
 			case "doi":
+				if v, err := doi.Parse(id.Value); err == nil {
+					works[i].ExternalIDs[ii].URL = template.HTML(v.URL())
+					works[i].DoiURI = template.HTML(v.URL())
+					continue
+				}
 				if len(id.URL) > 0 {
 					uri = string(id.URL)
 				} else if len(id.Value) > 0 {
-					uri = fmt.Sprintf("http://doi.org/%s", id.Value)
+					uri = fmt.Sprintf("https://doi.org/%s", id.Value)
 				} else {
 					continue
 				}
@@ -58,21 +65,6 @@ func UpdateExternalIDsURL(works []*Work) {
 	}
 }
 
-// UpdateContributorsLine populates a slice of works with an URI for
-// external ids if its value is missing.
-func UpdateContributorsLine(works []*Work) {
-	for i, w := range works {
-		contribs := make([]string, len(w.Contributors))
-		for ii, c := range w.Contributors {
-			contribs[ii] = c.Name
-		}
-
-		// formatting of contributors is according to
-		// https://research.moreheadstate.edu/c.php?g=107001&p=695197
-		works[i].ContributorsLine = strings.Join(contribs, ", ")
-	}
-}
-
 // UpdateMarkup is a tricky function and relies on the underlying
 // template which is passed by a client. So the client must be aware
 // of what is going on here to effectively render works.
@@ -93,13 +85,5 @@ func UpdateMarkup(works []*Work) {
 					"<sup>", "</nowiki>{{sup|"),
 				"</sup>", "}}<nowiki>"),
 		)
-		contribs := make([]string, len(w.Contributors))
-		for ii, c := range w.Contributors {
-			contribs[ii] = c.Name
-		}
-
-		// formatting of contributors is according to
-		// https://research.moreheadstate.edu/c.php?g=107001&p=695197
-		works[i].ContributorsLine = strings.Join(contribs, ", ")
 	}
 }
@@ -1,11 +1,14 @@
 // Package orcid provides an API for research works fetching using the
-// ORCID Public HTTP API.
+// ORCID Public HTTP API. The Member API can be used as well if the
+// client is created with institutional credentials.
 //
 // Check the ORCID docs:
 // https://members.orcid.org/api/about-public-api.
 package orcid
 
 import (
+	"context"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"html/template"
@@ -16,28 +19,216 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
+	"bitbucket.org/iharsuvorau/ims-publications/internal/throttle"
 )
 
 // Client is the ORCID API client for requests handling.
 type Client struct {
-	apiBase *url.URL
+	apiBase    *url.URL
+	version    Version
+	format     Format
+	auth       *authenticator
+	limiter    *throttle.Limiter
+	backoff    throttle.Backoff
+	httpClient *http.Client
+}
+
+// Option configures a client.
+type Option func(*Client)
+
+// WithVersion sets the API version instead of the one from the base URL.
+func WithVersion(v Version) Option {
+	return func(c *Client) {
+		c.version = v
+	}
+}
+
+// WithFormat sets the media type requested from the API, XML is used
+// by default.
+func WithFormat(f Format) Option {
+	return func(c *Client) {
+		c.format = f
+	}
+}
+
+// WithRateLimit limits the rate of requests made by the client and all
+// its goroutines to rps requests per second. There is no limit by
+// default.
+func WithRateLimit(rps float64) Option {
+	return func(c *Client) {
+		c.limiter = throttle.NewLimiter(rps)
+	}
+}
+
+// WithRetries sets the amount of retries of a request failed because of
+// a network error, the 429 or 5xx status. Retries are delayed
+// exponentially starting from a second or as the Retry-After header
+// asks. Three retries are made by default.
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		c.backoff.Retries = n
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for all requests including
+// token ones, e.g. to configure timeouts, a proxy or a transport.
+// http.DefaultClient is used by default.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
 }
 
-// New return a client.
-func New(apiBase string) (*Client, error) {
+// New return a client. The API version is taken from the last segment
+// of the base URL path, e.g. https://pub.orcid.org/v3.0, if the base URL
+// has no version, V21 is used unless another one is set by WithVersion.
+func New(apiBase string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(apiBase, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		limiter:    throttle.NewLimiter(0),
+		backoff:    throttle.Backoff{Retries: 3, Min: time.Second, Max: time.Second * 30},
+		httpClient: http.DefaultClient,
+	}
+
+	// splitting the version from the base
+	if i := strings.LastIndex(u.Path, "/"); i >= 0 && strings.HasPrefix(u.Path[i+1:], "v") {
+		c.version = Version(u.Path[i+1:])
+		u.Path = u.Path[:i]
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+	if len(c.version) == 0 {
+		c.version = V21
+	}
+	if len(c.format) == 0 {
+		c.format = XML
+	}
+	if _, err = c.decoder(); err != nil {
+		return nil, err
+	}
+
 	// the leading slash is needed to resolve dependent URLs further
-	apiBase = strings.TrimRight(apiBase, "/") + "/"
+	u.Path = fmt.Sprintf("%s/%s/", u.Path, c.version)
+	c.apiBase = u
 
-	u, err := url.Parse(apiBase)
+	if c.auth != nil && len(c.auth.tokenURL) == 0 {
+		c.auth.tokenURL = defaultTokenURL(u)
+	}
+
+	return c, nil
+}
+
+// APIBase returns the base URL including the version.
+func (c *Client) APIBase() *url.URL {
+	return c.apiBase
+}
+
+// Version returns the API version used by the client.
+func (c *Client) Version() Version {
+	return c.version
+}
+
+// Format returns the media type requested by the client.
+func (c *Client) Format() Format {
+	return c.format
+}
+
+// get requests a resource relative to the versioned base URL. Waiting
+// for the rate limit and retries stop when the context is done.
+func (c *Client) get(ctx context.Context, path string) (*http.Response, error) {
+	// paths returned by the API start with a slash and omit the
+	// version, so it's trimmed to resolve paths against the base
+	relURL, err := url.Parse(strings.TrimLeft(path, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("url.Parse failed: %v", err)
+	}
+	reqURL := c.apiBase.ResolveReference(relURL)
+
+	var resp *http.Response
+	for retry := 0; ; retry++ {
+		if err = c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		resp, err = c.do(ctx, reqURL.String())
+		if err == nil && !throttle.Retryable(resp.StatusCode) || retry >= c.backoff.Retries {
+			break
+		}
+
+		delay := c.backoff.Delay(retry)
+		if err == nil {
+			if d, ok := throttle.RetryAfter(resp.Header); ok {
+				delay = d
+			}
+			resp.Body.Close()
+		}
+		if err = throttle.Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{apiBase: u}, nil
+	if resp.StatusCode >= 300 {
+		respData, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("http.Get bad response, code %v, request URL: %v, response: %s",
+			resp.StatusCode, reqURL, respData)
+	}
+
+	return resp, nil
+}
+
+// do makes a request with an access token if the client has
+// credentials.
+func (c *Client) do(ctx context.Context, uri string) (*http.Response, error) {
+	resp, token, err := c.doWithToken(ctx, uri, "")
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && len(token) > 0 {
+		// the token might be revoked or expired earlier than it was
+		// promised, so another one is requested
+		resp.Body.Close()
+		resp, _, err = c.doWithToken(ctx, uri, token)
+	}
+	return resp, err
+}
+
+// doWithToken makes a request and returns the access token it's made
+// with, the rejected token is renewed unless it's renewed already.
+func (c *Client) doWithToken(ctx context.Context, uri string, rejected string) (*http.Response, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", string(c.format))
+
+	var token string
+	if c.auth != nil {
+		token, err = c.auth.token(ctx, c.httpClient, rejected)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get an access token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	return resp, token, err
 }
 
 // ID is an ORCID.
@@ -66,12 +257,6 @@ func (id ID) String() string {
 	return string(id)
 }
 
-// Activity is the ORCID <activities:works> XML element.
-type Activity struct {
-	XMLName xml.Name `xml:"works"`
-	Works   []Work   `xml:"group>work-summary"`
-}
-
 // Work is the ORCID <work:work> and <work:work-summary> XML elements.
 type Work struct {
 	// Common
@@ -97,8 +282,13 @@ type Work struct {
 
 	// Convenience fields. Do not belong to the ORCID schema. Used in templates
 
-	DoiURI           template.HTML
-	ContributorsLine string
+	DoiURI template.HTML
+	// Preprints are earlier versions of the work, e.g. on arXiv, shown
+	// together with it instead of separate works.
+	Preprints []*Work
+	// Members are names of group members who have the work in their
+	// profiles, it's set for pages aggregating works of several people.
+	Members []string
 }
 
 // ExternalID represents an ID assigned to a work. One work can have many IDs in different registries.
@@ -129,6 +319,51 @@ func (w *Work) GetDOI() *ExternalID {
 	return nil
 }
 
+// DOI returns the parsed DOI of a work from its external ids or the
+// DOI link.
+func (w *Work) DOI() (doi.DOI, error) {
+	for _, id := range w.ExternalIDs {
+		if id.Type != "doi" {
+			continue
+		}
+		if v, err := doi.Parse(id.Value); err == nil {
+			return v, nil
+		}
+		if v, err := doi.Parse(string(id.URL)); err == nil {
+			return v, nil
+		}
+	}
+	if len(w.DoiURI) > 0 {
+		return doi.Parse(string(w.DoiURI))
+	}
+	return "", fmt.Errorf("no DOI for %q", w.Title)
+}
+
+// PutCode returns the ORCID identifier of a work in the profile taken
+// from its path, e.g. 12345 of /0000-0002-0183-1282/work/12345.
+func (w *Work) PutCode() string {
+	i := strings.LastIndex(w.Path, "/work/")
+	if i < 0 {
+		return ""
+	}
+	return w.Path[i+len("/work/"):]
+}
+
+// ArXivID returns the arXiv identifier of a work without the "arXiv:"
+// prefix, e.g. 1801.00001v2, or an empty string.
+func (w *Work) ArXivID() string {
+	for _, id := range w.ExternalIDs {
+		if strings.EqualFold(id.Type, "arxiv") && len(id.Value) > 0 {
+			v := strings.TrimSpace(id.Value)
+			if strings.HasPrefix(strings.ToLower(v), "arxiv:") {
+				v = v[len("arxiv:"):]
+			}
+			return v
+		}
+	}
+	return ""
+}
+
 // ExternalIDValue returns ExternalID.Value by ExternalID.Type.
 // func (w *Work) ExternalIDValue(s string) string {
 // 	if w == nil {
@@ -152,7 +387,36 @@ type Citation struct {
 
 // Contributor is an ORCID contributor.
 type Contributor struct {
-	Name string `xml:"credit-name"`
+	Name  string `xml:"credit-name"`
+	ORCID ID     `xml:"contributor-orcid>path"`
+	// Sequence is "first" for the first author and "additional" for
+	// others.
+	Sequence string `xml:"contributor-attributes>contributor-sequence"`
+	Role     string `xml:"contributor-attributes>contributor-role"`
+
+	// Given and family names do not belong to the ORCID schema, they
+	// are filled from other registries, e.g. CrossRef.
+
+	GivenName  string
+	FamilyName string
+}
+
+// Names returns the given and family names of the contributor. If they
+// are unknown, they are guessed from the credit name which is either
+// "Family, Given" or "Given Family".
+func (c *Contributor) Names() (given, family string) {
+	if len(c.FamilyName) > 0 {
+		return c.GivenName, c.FamilyName
+	}
+
+	name := strings.TrimSpace(c.Name)
+	if i := strings.Index(name, ","); i >= 0 {
+		return strings.TrimSpace(name[i+1:]), strings.TrimSpace(name[:i])
+	}
+	if i := strings.LastIndex(name, " "); i >= 0 {
+		return strings.TrimSpace(name[:i]), name[i+1:]
+	}
+	return "", name
 }
 
 // WorksModifier is a general type for any function you can pass to FetchWorks
@@ -160,14 +424,40 @@ type Contributor struct {
 // library might need.
 type WorksModifier func([]*Work)
 
-// FetchWorks downloads publications from ORCID.
-func FetchWorks(c *Client, id ID, logger *log.Logger, mods ...WorksModifier) ([]*Work, error) {
+// PartialError is returned along with the fetched works when details of
+// some works could not be fetched even after retries.
+type PartialError struct {
+	// Failed maps paths of the works which were not fetched to errors.
+	Failed map[string]error
+	// Total is the amount of works which details were requested.
+	Total int
+}
+
+func (e *PartialError) Error() string {
+	paths := make([]string, 0, len(e.Failed))
+	for path := range e.Failed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	msgs := make([]string, len(paths))
+	for i, path := range paths {
+		msgs[i] = fmt.Sprintf("%s: %v", path, e.Failed[path])
+	}
+
+	return fmt.Sprintf("%d of %d works were not fetched: %s", len(e.Failed), e.Total, strings.Join(msgs, "; "))
+}
+
+// FetchWorks downloads publications from ORCID. If some works could not
+// be fetched, the rest of them is returned with *PartialError. If the
+// context is done before all works are fetched, an error is returned.
+func FetchWorks(ctx context.Context, c *Client, id ID, logger *log.Logger, mods ...WorksModifier) ([]*Work, error) {
 	var works []*Work
 	var err error
 
 	logger.Println("downloading via HTTP")
-	works, err = fetchWorks(c, id, logger)
-	if err != nil {
+	works, err = fetchWorks(ctx, c, id, logger)
+	if _, ok := err.(*PartialError); err != nil && !ok {
 		return nil, fmt.Errorf("fetchWorks failed: %v", err)
 	}
 
@@ -180,12 +470,110 @@ func FetchWorks(c *Client, id ID, logger *log.Logger, mods ...WorksModifier) ([]
 		mod(works)
 	}
 
-	return works, nil
+	return works, err
+}
+
+// SyncReport describes the difference between cached works and the
+// current ORCID record found by SyncWorks.
+type SyncReport struct {
+	Added     int
+	Modified  int
+	Deleted   int
+	Unchanged int
+}
+
+// String returns a human readable summary of the report.
+func (r *SyncReport) String() string {
+	return fmt.Sprintf("added: %d, modified: %d, deleted: %d, unchanged: %d",
+		r.Added, r.Modified, r.Deleted, r.Unchanged)
+}
+
+// SyncWorks updates previously fetched works of a user. It downloads
+// work summaries only and fetches details of the works which are new or
+// which last modification date differs from the cached one. Works
+// missing in the summaries are considered deleted and dropped.
+//
+// Modifiers are applied to the fetched works only, because the cached
+// works are expected to be modified by the previous FetchWorks or
+// SyncWorks call.
+//
+// If some works could not be fetched, the rest of them is returned with
+// *PartialError. Cached versions are kept for modified works which
+// failed, so they are fetched again by the next call.
+func SyncWorks(ctx context.Context, c *Client, id ID, cached []*Work, logger *log.Logger, mods ...WorksModifier) ([]*Work, *SyncReport, error) {
+	summaries, err := fetchSummaries(ctx, c, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetchSummaries failed: %v", err)
+	}
+
+	byPath := make(map[string]*Work, len(cached))
+	for _, w := range cached {
+		byPath[w.Path] = w
+	}
+
+	report := SyncReport{}
+	works := []*Work{}
+	outdated := []Work{}
+	seen := make(map[string]bool, len(*summaries))
+	for _, s := range *summaries {
+		seen[s.Path] = true
+		w, ok := byPath[s.Path]
+		switch {
+		case !ok:
+			report.Added++
+			outdated = append(outdated, s)
+		case !w.Modified.Equal(s.Modified):
+			report.Modified++
+			outdated = append(outdated, s)
+		default:
+			report.Unchanged++
+			works = append(works, w)
+		}
+	}
+	for _, w := range cached {
+		if !seen[w.Path] {
+			report.Deleted++
+		}
+	}
+
+	var perr *PartialError
+	if len(outdated) > 0 {
+		var fetched []*Work
+		fetched, perr = fetchDetails(ctx, c, outdated, logger)
+		if err = ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		for _, mod := range mods {
+			mod(fetched)
+		}
+
+		works = append(works, fetched...)
+
+		if perr != nil {
+			for path := range perr.Failed {
+				if w, ok := byPath[path]; ok {
+					works = append(works, w)
+				}
+			}
+		}
+	}
+
+	// sort works in year descending order
+	sort.Slice(works, func(i, j int) bool {
+		return works[i].Year > works[j].Year
+	})
+
+	if perr != nil {
+		return works, &report, perr
+	}
+	return works, &report, nil
 }
 
 // ReadWorks decodes publications from an XML-file with publications
 // saved as top-level elements. Basically, it decodes an output of
-// xml.Marshal([]*Work) back into []*Work.
+// xml.Marshal([]*Work) back into []*Work. Files with the .json
+// extension are decoded as an output of json.Marshal([]*Work).
 func ReadWorks(path string, mods ...WorksModifier) ([]*Work, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -193,6 +581,17 @@ func ReadWorks(path string, mods ...WorksModifier) ([]*Work, error) {
 	}
 	defer f.Close()
 
+	if filepath.Ext(path) == ".json" {
+		works := []*Work{}
+		if err = json.NewDecoder(f).Decode(&works); err != nil {
+			return nil, err
+		}
+		for _, mod := range mods {
+			mod(works)
+		}
+		return works, nil
+	}
+
 	d := xml.NewDecoder(f)
 
 	// read top level elements continuously
@@ -216,38 +615,64 @@ func ReadWorks(path string, mods ...WorksModifier) ([]*Work, error) {
 	return works, nil
 }
 
-func fetchWork(uri string) (*Work, error) {
-	resp, err := http.Get(uri)
+func fetchWork(ctx context.Context, c *Client, path string) (*Work, error) {
+	dec, err := c.decoder()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.get(ctx, path)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	work := Work{}
-	err = xml.NewDecoder(resp.Body).Decode(&work)
+	work, err := dec.decodeWork(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("response status: %v, error: %v", resp.Status, err)
 	}
 
-	return &work, nil
+	return work, nil
 }
 
-func fetchWorks(c *Client, id ID, logger *log.Logger) ([]*Work, error) {
-	// fetch summaries
-	relURL, err := url.Parse(fmt.Sprintf("%s/works", id))
+func fetchWorks(ctx context.Context, c *Client, id ID, logger *log.Logger) ([]*Work, error) {
+	summaries, err := fetchSummaries(ctx, c, id)
 	if err != nil {
-		return nil, fmt.Errorf("url.Parse failed: %v", err)
+		return nil, err
 	}
-	reqURL := c.apiBase.ResolveReference(relURL)
-	summaries, err := fetchWorkSummaries(reqURL.String())
+
+	// a done context fails all remaining works, so it's not a partial
+	// failure
+	works, perr := fetchDetails(ctx, c, *summaries, logger)
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	if perr != nil {
+		return works, perr
+	}
+
+	return works, nil
+}
+
+func fetchSummaries(ctx context.Context, c *Client, id ID) (*[]Work, error) {
+	summaries, err := fetchWorkSummaries(ctx, c, fmt.Sprintf("%s/works", id))
 	if err != nil {
 		return nil, fmt.Errorf("fetchWorkSummaries failed: %v", err)
 	}
+	return summaries, nil
+}
 
-	// fetch details concurrently
+// fetchDetails fetches details for work summaries concurrently. Works
+// which could not be fetched are reported by *PartialError.
+func fetchDetails(ctx context.Context, c *Client, summaries []Work, logger *log.Logger) ([]*Work, *PartialError) {
+	type result struct {
+		path string
+		work *Work
+		err  error
+	}
 
-	num := len(*summaries)
-	worksCh := make(chan *Work, num)
+	num := len(summaries)
+	resultsCh := make(chan result, num)
 	var wg sync.WaitGroup
 	for n := 0; n < int(math.Ceil(float64(num)/20.0)); n++ {
 		start := n * 20
@@ -255,114 +680,81 @@ func fetchWorks(c *Client, id ID, logger *log.Logger) ([]*Work, error) {
 		if end > num {
 			end = num
 		}
-		for _, w := range (*summaries)[start:end] {
+		for _, w := range summaries[start:end] {
 			wg.Add(1)
-			go func(w Work, works chan<- *Work) {
+			go func(w Work, results chan<- result) {
 				defer wg.Done()
 
-				relURL, err := url.Parse(w.Path)
-				if err != nil {
-					logger.Printf("url.Parse failed: %v", err)
-					return
-				}
-
-				reqURL := c.apiBase.ResolveReference(relURL)
-				logger.Println("fetching", reqURL.String())
-				work, err := fetchWork(reqURL.String())
+				logger.Println("fetching", w.Path)
+				work, err := fetchWork(ctx, c, w.Path)
 				if err != nil {
 					logger.Println(err)
-					return
 				}
-				works <- work
-			}(w, worksCh)
+				results <- result{path: w.Path, work: work, err: err}
+			}(w, resultsCh)
 		}
 		wg.Wait()
 	}
-	close(worksCh)
+	close(resultsCh)
 
 	works := []*Work{}
-	for w := range worksCh {
-		if w != nil {
-			works = append(works, w)
+	failed := make(map[string]error)
+	for r := range resultsCh {
+		if r.err != nil {
+			failed[r.path] = r.err
+			continue
 		}
+		works = append(works, r.work)
 	}
 
-	if len(*summaries) != len(works) {
-		logger.Printf("different amount of publications: %v vs %v", len(*summaries), len(works))
+	if len(failed) > 0 {
+		return works, &PartialError{Failed: failed, Total: num}
 	}
-
 	return works, nil
 }
 
-func fetchWorkSummaries(uri string) (*[]Work, error) {
-	resp, err := http.Get(uri)
+func fetchWorkSummaries(ctx context.Context, c *Client, path string) (*[]Work, error) {
+	dec, err := c.decoder()
 	if err != nil {
-		return nil, fmt.Errorf("http.Get failed with code %d: %v", resp.StatusCode, err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 300 {
-		respData, _ := ioutil.ReadAll(resp.Body)
-		return nil, fmt.Errorf("http.Get bad response, code %v, request URL: %v, response: %s",
-			resp.StatusCode, uri, respData)
+	resp, err := c.get(ctx, path)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	works, err := decodeWorks(resp.Body)
+	works, err := dec.decodeSummaries(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("decodeWorks failed: %v", err)
+		return nil, fmt.Errorf("decodeSummaries failed: %v", err)
 	}
 
 	return works, nil
 }
 
+// decodeWorks decodes the <activities:works> element of API v2.1. Only
+// the preferred summary of a group is taken like in v3.0, which is the
+// one with the highest display index, so details of the same work from
+// other sources are not fetched.
 func decodeWorks(src io.Reader) (*[]Work, error) {
-	activities := []Activity{}
-	err := xml.NewDecoder(src).Decode(&activities)
-	if err != nil {
+	data := v21Works{}
+	if err := xml.NewDecoder(src).Decode(&data); err != nil {
 		return nil, err
 	}
 
 	works := []Work{}
-	for _, a := range activities {
-		works = append(works, a.Works...)
-	}
-	uniqueWorks := filterUniqueTitles(&works)
-	return uniqueWorks, nil
-}
-
-// filterUniqueTitles filters works by a unique title and adds to the
-// returned slice only the first item met. Checking by title, because
-// publications with the same titles can have different type of IDs.
-func filterUniqueTitles(works *[]Work) *[]Work {
-	uniqueWorks := []Work{}
-	var unique bool
-	for _, w := range *works {
-		unique = true
-		for _, uw := range uniqueWorks {
-			// lowering strings and removing all spaces,
-			// because people sometimes mess with spaces
-			// and capitalization while naming their works
-			if simplifyString(string(w.Title)) == simplifyString(string(uw.Title)) {
-				unique = false
-				break
-			}
+	for _, g := range data.Groups {
+		if len(g.Summaries) == 0 {
+			continue
 		}
-		if unique {
-			uniqueWorks = append(uniqueWorks, w)
+		preferred := g.Summaries[0]
+		for _, s := range g.Summaries[1:] {
+			if s.DisplayIndex > preferred.DisplayIndex {
+				preferred = s
+			}
 		}
+		works = append(works, preferred.Work)
 	}
-	return &uniqueWorks
-}
-
-// simplifyString removes some punctuation from a string.
-func simplifyString(s string) string {
-	return strings.ReplaceAll(
-		strings.ReplaceAll(
-			strings.ReplaceAll(
-				strings.ReplaceAll(
-					strings.ToLower(s),
-					" ", ""),
-				"(", ""),
-			")", ""),
-		"-", "")
+	return &works, nil
 }
@@ -2,13 +2,20 @@ package orcid
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
 	"html/template"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func dumpWorks(works []*Work, fpath string) error {
@@ -125,7 +132,7 @@ func TestFetchWorks(t *testing.T) {
 			t.Errorf("want %v, got %v", arg[1], idStr)
 		}
 
-		works, err := FetchWorks(client, id, logger, UpdateExternalIDsURL, UpdateContributorsLine, UpdateMarkup)
+		works, err := FetchWorks(context.Background(), client, id, logger, UpdateExternalIDsURL, UpdateMarkup)
 		if err != nil {
 			t.Error(err)
 		}
@@ -185,3 +192,715 @@ func TestRender(t *testing.T) {
 		t.Error("length of markup must be greater than zero")
 	}
 }
+
+// testSummaryXML and testWorkXML are ORCID API v2.1 responses with
+// placeholders for a put-code, a modification date and a title.
+const (
+	testSummaryXML = `<work:work-summary put-code="%[1]d" path="/0000-0002-0183-1282/work/%[1]d">
+<common:last-modified-date>%[2]s</common:last-modified-date>
+<work:title><common:title>%[3]s</common:title></work:title>
+<work:type>journal-article</work:type>
+<common:publication-date><common:year>2018</common:year></common:publication-date>
+</work:work-summary>`
+	testWorkXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<work:work put-code="%[1]d" path="/0000-0002-0183-1282/work/%[1]d" xmlns:common="http://www.orcid.org/ns/common" xmlns:work="http://www.orcid.org/ns/work">
+<common:last-modified-date>%[2]s</common:last-modified-date>
+<work:title><common:title>%[3]s</common:title></work:title>
+<work:journal-title>Journal</work:journal-title>
+<work:type>journal-article</work:type>
+<common:publication-date><common:year>2018</common:year></common:publication-date>
+</work:work>`
+)
+
+type testWork struct {
+	putCode  int
+	modified string
+	title    string
+}
+
+// newTestServer serves v2.1 summaries and details of the works and
+// counts requests of details.
+func newTestServer(t *testing.T, works []testWork, detailRequests *int) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2.1/0000-0002-0183-1282/works" {
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<activities:works xmlns:activities="http://www.orcid.org/ns/activities" xmlns:common="http://www.orcid.org/ns/common" xmlns:work="http://www.orcid.org/ns/work">`)
+			for _, v := range works {
+				fmt.Fprint(w, "<activities:group>")
+				fmt.Fprintf(w, testSummaryXML, v.putCode, v.modified, v.title)
+				fmt.Fprint(w, "</activities:group>")
+			}
+			fmt.Fprint(w, "</activities:works>")
+			return
+		}
+		for _, v := range works {
+			if strings.HasSuffix(r.URL.Path, fmt.Sprintf("/0000-0002-0183-1282/work/%d", v.putCode)) {
+				mu.Lock()
+				*detailRequests++
+				mu.Unlock()
+				fmt.Fprintf(w, testWorkXML, v.putCode, v.modified, v.title)
+				return
+			}
+		}
+		t.Errorf("unexpected request: %s", r.URL)
+		http.NotFound(w, r)
+	}))
+}
+
+func TestSyncWorks(t *testing.T) {
+	const id = ID("0000-0002-0183-1282")
+	var logger = log.New(ioutil.Discard, "", log.LstdFlags)
+
+	var requests int
+	srv := newTestServer(t, []testWork{
+		{1, "2019-01-01T00:00:00.000Z", "First"},
+		{2, "2019-01-01T00:00:00.000Z", "Second"},
+		{3, "2019-01-01T00:00:00.000Z", "Third"},
+	}, &requests)
+	client, err := New(srv.URL + "/v2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := FetchWorks(context.Background(), client, id, logger)
+	srv.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != 3 || requests != 3 {
+		t.Fatalf("want 3 works and 3 requests, got %v and %v", len(cached), requests)
+	}
+
+	// the second work is modified, the third one is deleted and the
+	// fourth one is added
+	requests = 0
+	srv = newTestServer(t, []testWork{
+		{1, "2019-01-01T00:00:00.000Z", "First"},
+		{2, "2019-02-01T00:00:00.000Z", "Second, modified"},
+		{4, "2019-01-01T00:00:00.000Z", "Fourth"},
+	}, &requests)
+	defer srv.Close()
+	client, err = New(srv.URL + "/v2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var modified int
+	works, report, err := SyncWorks(context.Background(), client, id, cached, logger, func(works []*Work) {
+		modified += len(works)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := SyncReport{Added: 1, Modified: 1, Deleted: 1, Unchanged: 1}
+	if *report != want {
+		t.Errorf("want report %+v, got %+v", want, *report)
+	}
+	if requests != 2 || modified != 2 {
+		t.Errorf("only new and modified works must be fetched and modified, got %v requests and %v modified", requests, modified)
+	}
+
+	titles := map[string]bool{}
+	for _, w := range works {
+		titles[string(w.Title)] = true
+	}
+	if len(works) != 3 || !titles["First"] || !titles["Second, modified"] || !titles["Fourth"] {
+		t.Errorf("unexpected works: %+v", titles)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		apiBase string
+		opts    []Option
+		base    string
+		version Version
+		wantErr bool
+	}{
+		{
+			name:    "A",
+			apiBase: "https://pub.orcid.org/v2.1",
+			base:    "https://pub.orcid.org/v2.1/",
+			version: V21,
+		},
+		{
+			name:    "B",
+			apiBase: "https://pub.orcid.org/v3.0/",
+			base:    "https://pub.orcid.org/v3.0/",
+			version: V30,
+		},
+		{
+			name:    "C",
+			apiBase: "https://pub.orcid.org",
+			base:    "https://pub.orcid.org/v2.1/",
+			version: V21,
+		},
+		{
+			name:    "D",
+			apiBase: "https://pub.orcid.org/v2.1",
+			opts:    []Option{WithVersion(V30)},
+			base:    "https://pub.orcid.org/v3.0/",
+			version: V30,
+		},
+		{
+			name:    "E",
+			apiBase: "https://pub.orcid.org/v1.2",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.apiBase, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if c.APIBase().String() != tt.base {
+				t.Errorf("want base %v, got %v", tt.base, c.APIBase())
+			}
+			if c.Version() != tt.version {
+				t.Errorf("want version %v, got %v", tt.version, c.Version())
+			}
+		})
+	}
+}
+
+func Test_v21Decoder(t *testing.T) {
+	const summaries = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<activities:works xmlns:activities="http://www.orcid.org/ns/activities" xmlns:common="http://www.orcid.org/ns/common" xmlns:work="http://www.orcid.org/ns/work">
+  <activities:group>
+    <work:work-summary put-code="1" path="/0000-0002-0183-1282/work/1" display-index="0">
+      <work:title><common:title>Other Source</common:title></work:title>
+    </work:work-summary>
+    <work:work-summary put-code="2" path="/0000-0002-0183-1282/work/2" display-index="1">
+      <work:title><common:title>Preferred</common:title></work:title>
+      <common:publication-date><common:year>2018</common:year></common:publication-date>
+    </work:work-summary>
+  </activities:group>
+  <activities:group>
+    <work:work-summary put-code="3" path="/0000-0002-0183-1282/work/3" display-index="0">
+      <work:title><common:title>Single</common:title></work:title>
+    </work:work-summary>
+  </activities:group>
+</activities:works>`
+
+	works, err := v21Decoder{}.decodeSummaries(strings.NewReader(summaries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*works) != 2 {
+		t.Fatalf("want one summary per group, got %v", len(*works))
+	}
+	if s := (*works)[0]; s.Title != "Preferred" || s.Path != "/0000-0002-0183-1282/work/2" || s.Year != 2018 {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+	if s := (*works)[1]; s.Title != "Single" {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+}
+
+func Test_v30Decoder(t *testing.T) {
+	const summaries = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<activities:works path="/0000-0002-0183-1282/works" xmlns:common="http://www.orcid.org/ns/common" xmlns:work="http://www.orcid.org/ns/work" xmlns:activities="http://www.orcid.org/ns/activities">
+  <common:last-modified-date>2019-06-01T10:00:00.000Z</common:last-modified-date>
+  <activities:group>
+    <common:last-modified-date>2019-06-01T10:00:00.000Z</common:last-modified-date>
+    <common:external-ids>
+      <common:external-id>
+        <common:external-id-type>doi</common:external-id-type>
+        <common:external-id-value>10.3390/act7010007</common:external-id-value>
+      </common:external-id>
+    </common:external-ids>
+    <work:work-summary put-code="2" path="/0000-0002-0183-1282/work/2" display-index="0">
+      <common:last-modified-date>2019-05-01T10:00:00.000Z</common:last-modified-date>
+      <common:source><common:source-name>Crossref</common:source-name></common:source>
+      <work:title><common:title>Copy</common:title></work:title>
+      <work:type>journal-article</work:type>
+    </work:work-summary>
+    <work:work-summary put-code="1" path="/0000-0002-0183-1282/work/1" display-index="1">
+      <common:last-modified-date>2019-06-01T10:00:00.000Z</common:last-modified-date>
+      <common:source><common:source-name>Scopus</common:source-name></common:source>
+      <work:title><common:title>Preferred</common:title></work:title>
+      <common:external-ids>
+        <common:external-id>
+          <common:external-id-type>doi</common:external-id-type>
+          <common:external-id-value>10.3390/act7010007</common:external-id-value>
+          <common:external-id-url>https://doi.org/10.3390/act7010007</common:external-id-url>
+        </common:external-id>
+      </common:external-ids>
+      <common:url>https://www.mdpi.com/2076-0825/7/1/7</common:url>
+      <work:type>journal-article</work:type>
+      <common:publication-date><common:year>2018</common:year><common:month>03</common:month></common:publication-date>
+      <work:journal-title>Actuators</work:journal-title>
+    </work:work-summary>
+  </activities:group>
+</activities:works>`
+
+	const work = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<work:work put-code="1" path="/0000-0002-0183-1282/work/1" xmlns:common="http://www.orcid.org/ns/common" xmlns:work="http://www.orcid.org/ns/work">
+  <common:last-modified-date>2019-06-01T10:00:00.000Z</common:last-modified-date>
+  <work:title><common:title>Preferred</common:title></work:title>
+  <work:journal-title>Actuators</work:journal-title>
+  <work:citation>
+    <work:citation-type>bibtex</work:citation-type>
+    <work:citation-value>@article{a}</work:citation-value>
+  </work:citation>
+  <work:type>journal-article</work:type>
+  <common:publication-date><common:year>2018</common:year></common:publication-date>
+  <common:url>https://www.mdpi.com/2076-0825/7/1/7</common:url>
+  <work:contributors>
+    <work:contributor>
+      <common:contributor-orcid>
+        <common:uri>https://orcid.org/0000-0002-0183-1282</common:uri>
+        <common:path>0000-0002-0183-1282</common:path>
+        <common:host>orcid.org</common:host>
+      </common:contributor-orcid>
+      <work:credit-name>Jane Doe</work:credit-name>
+      <work:contributor-attributes>
+        <work:contributor-sequence>first</work:contributor-sequence>
+        <work:contributor-role>author</work:contributor-role>
+      </work:contributor-attributes>
+    </work:contributor>
+    <work:contributor>
+      <work:credit-name>John Doe</work:credit-name>
+      <work:contributor-attributes>
+        <work:contributor-role>https://credit.niso.org/contributor-roles/writing-original-draft/</work:contributor-role>
+      </work:contributor-attributes>
+    </work:contributor>
+  </work:contributors>
+</work:work>`
+
+	dec := v30Decoder{}
+
+	works, err := dec.decodeSummaries(strings.NewReader(summaries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*works) != 1 {
+		t.Fatalf("want one summary per group, got %v", len(*works))
+	}
+	s := (*works)[0]
+	if s.Title != "Preferred" || s.Path != "/0000-0002-0183-1282/work/1" || s.Year != 2018 || s.Month != 3 ||
+		s.URI != "https://www.mdpi.com/2076-0825/7/1/7" || s.JournalTitle != "Actuators" || s.SourceName != "Scopus" ||
+		!s.HasDOI() || s.GetDOI().Value != "10.3390/act7010007" || s.Modified.Month() != time.June {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+
+	w, err := dec.decodeWork(strings.NewReader(work))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Title != "Preferred" || w.Type != "journal-article" || w.Citation == nil || w.Citation.Type != "bibtex" ||
+		w.URI != "https://www.mdpi.com/2076-0825/7/1/7" || len(w.Contributors) != 2 {
+		t.Fatalf("unexpected work: %+v", w)
+	}
+	if c := w.Contributors[0]; c.Name != "Jane Doe" || c.Role != "author" || c.Sequence != "first" || c.ORCID != "0000-0002-0183-1282" {
+		t.Errorf("unexpected contributor: %+v", c)
+	}
+	if c := w.Contributors[1]; c.Name != "John Doe" || c.Role != "writing-original-draft" {
+		t.Errorf("unexpected contributor: %+v", c)
+	}
+}
+
+func Test_jsonDecoder(t *testing.T) {
+	const summaries = `{
+  "last-modified-date": {"value": 1559383200000},
+  "group": [{
+    "external-ids": {"external-id": []},
+    "work-summary": [{
+      "put-code": 2,
+      "path": "/0000-0002-0183-1282/work/2",
+      "display-index": "0",
+      "last-modified-date": {"value": 1556704800000},
+      "title": {"title": {"value": "Copy"}, "subtitle": null},
+      "type": "%[1]s"
+    }, {
+      "put-code": 1,
+      "path": "/0000-0002-0183-1282/work/1",
+      "display-index": "1",
+      "created-date": {"value": 1556704800000},
+      "last-modified-date": {"value": 1559383200000},
+      "source": {"source-name": {"value": "Scopus"}},
+      "title": {"title": {"value": "Preferred"}},
+      "external-ids": {"external-id": [{
+        "external-id-type": "%[2]s",
+        "external-id-value": "10.3390/act7010007",
+        "external-id-url": {"value": "https://doi.org/10.3390/act7010007"}
+      }]},
+      "type": "%[1]s",
+      "publication-date": {"year": {"value": "2018"}, "month": {"value": "03"}, "day": null}
+    }]
+  }]
+}`
+
+	const work = `{
+  "put-code": 1,
+  "path": "/0000-0002-0183-1282/work/1",
+  "last-modified-date": {"value": 1559383200000},
+  "title": {"title": {"value": "Preferred"}},
+  "journal-title": {"value": "Actuators"},
+  "citation": {"citation-type": "%[3]s", "citation-value": "@article{a}"},
+  "type": "%[1]s",
+  "publication-date": {"year": {"value": "2018"}},
+  "url": {"value": "https://www.mdpi.com/2076-0825/7/1/7"},
+  "contributors": {"contributor": [{
+    "credit-name": {"value": "Jane Doe"},
+    "contributor-attributes": {"contributor-sequence": null, "contributor-role": "%[4]s"}
+  }]}
+}`
+
+	tests := []struct {
+		name      string
+		version   Version
+		enums     []interface{}
+		summaries int
+	}{
+		{
+			name:      "v2.1",
+			version:   V21,
+			enums:     []interface{}{"JOURNAL_ARTICLE", "DOI", "BIBTEX", "AUTHOR"},
+			summaries: 1,
+		},
+		{
+			name:      "v3.0",
+			version:   V30,
+			enums:     []interface{}{"journal-article", "doi", "bibtex", "author"},
+			summaries: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := jsonDecoder{version: tt.version}
+
+			works, err := dec.decodeSummaries(strings.NewReader(fmt.Sprintf(summaries, tt.enums...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(*works) != tt.summaries {
+				t.Fatalf("want %v summaries, got %v", tt.summaries, len(*works))
+			}
+			s := (*works)[len(*works)-1]
+			if s.Title != "Preferred" || s.Type != "journal-article" || s.Year != 2018 || s.Month != 3 ||
+				!s.HasDOI() || s.SourceName != "Scopus" || !s.Modified.Equal(time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)) {
+				t.Errorf("unexpected summary: %+v", s)
+			}
+
+			w, err := dec.decodeWork(strings.NewReader(fmt.Sprintf(work, tt.enums...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w.Title != "Preferred" || w.JournalTitle != "Actuators" || w.Citation == nil || w.Citation.Type != "bibtex" ||
+				w.URI != "https://www.mdpi.com/2076-0825/7/1/7" || len(w.Contributors) != 1 ||
+				w.Contributors[0].Name != "Jane Doe" || w.Contributors[0].Role != "author" {
+				t.Errorf("unexpected work: %+v", w)
+			}
+		})
+	}
+}
+
+func TestClient_Format(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accept := r.Header.Get("Accept"); accept != string(JSON) {
+			t.Errorf("want Accept %v, got %v", JSON, accept)
+		}
+		fmt.Fprint(w, `{"group": [{"work-summary": [{"path": "/0000-0002-0183-1282/work/1", "title": {"title": {"value": "A"}}}]}]}`)
+	}))
+	defer srv.Close()
+
+	client, err := New(srv.URL+"/v3.0", WithFormat(JSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	works, err := fetchSummaries(context.Background(), client, ID("0000-0002-0183-1282"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*works) != 1 || (*works)[0].Title != "A" {
+		t.Errorf("unexpected works: %+v", *works)
+	}
+}
+
+func TestWithCredentials(t *testing.T) {
+	var tokenRequests, apiRequests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token":
+			tokenRequests++
+			if r.Method != "POST" || r.FormValue("grant_type") != "client_credentials" ||
+				r.FormValue("scope") != "/read-public" || r.FormValue("client_id") != "APP-1" ||
+				r.FormValue("client_secret") != "secret" {
+				t.Errorf("unexpected token request: %s %v", r.Method, r.Form)
+			}
+			fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","refresh_token":"r","expires_in":631138518,"scope":"/read-public","orcid":null}`, tokenRequests)
+		case "/v3.0/0000-0002-0183-1282/works":
+			apiRequests++
+			// the first token is revoked after the first request
+			if auth := r.Header.Get("Authorization"); apiRequests > 1 && auth == "Bearer token-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			} else if !strings.HasPrefix(auth, "Bearer token-") {
+				t.Errorf("unexpected authorization: %v", auth)
+			}
+			fmt.Fprint(w, `<activities:works xmlns:activities="http://www.orcid.org/ns/activities"></activities:works>`)
+		default:
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := New(srv.URL+"/v3.0", WithCredentials("APP-1", "secret"), WithTokenURL(srv.URL+"/oauth/token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err = fetchSummaries(context.Background(), client, ID("0000-0002-0183-1282")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the token is reused and renewed once after being revoked
+	if tokenRequests != 2 || apiRequests != 4 {
+		t.Errorf("want 2 token and 4 API requests, got %v and %v", tokenRequests, apiRequests)
+	}
+}
+
+func TestWithCredentials_concurrentRenewal(t *testing.T) {
+	var mu sync.Mutex
+	tokenRequests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token":
+			mu.Lock()
+			tokenRequests++
+			n := tokenRequests
+			mu.Unlock()
+			fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":631138518,"scope":"/read-public"}`, n)
+		case "/v3.0/0000-0002-0183-1282/works":
+			// the first token is revoked
+			if r.Header.Get("Authorization") == "Bearer token-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `<activities:works xmlns:activities="http://www.orcid.org/ns/activities"></activities:works>`)
+		default:
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := New(srv.URL+"/v3.0", WithCredentials("APP-1", "secret"), WithTokenURL(srv.URL+"/oauth/token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first token is acquired before the concurrent requests
+	if _, err = client.auth.token(context.Background(), client.httpClient, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := fetchSummaries(context.Background(), client, ID("0000-0002-0183-1282")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// requests rejected with the same token share a single renewal
+	if tokenRequests != 2 {
+		t.Errorf("want 2 token requests, got %v", tokenRequests)
+	}
+}
+
+func Test_defaultTokenURL(t *testing.T) {
+	tests := []struct {
+		apiBase string
+		want    string
+	}{
+		{"https://pub.orcid.org/v3.0", "https://orcid.org/oauth/token"},
+		{"https://api.orcid.org/v2.1", "https://orcid.org/oauth/token"},
+		{"https://pub.sandbox.orcid.org/v3.0", "https://sandbox.orcid.org/oauth/token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.apiBase, func(t *testing.T) {
+			c, err := New(tt.apiBase, WithCredentials("APP-1", "secret"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.auth.tokenURL != tt.want {
+				t.Errorf("want %v, got %v", tt.want, c.auth.tokenURL)
+			}
+		})
+	}
+}
+
+func TestFetchWorks_retries(t *testing.T) {
+	const id = ID("0000-0002-0183-1282")
+	var logger = log.New(ioutil.Discard, "", log.LstdFlags)
+
+	var mu sync.Mutex
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/v2.1/0000-0002-0183-1282/works":
+			fmt.Fprint(w, `<activities:works xmlns:activities="http://www.orcid.org/ns/activities" xmlns:common="http://www.orcid.org/ns/common" xmlns:work="http://www.orcid.org/ns/work">`)
+			for i := 1; i <= 3; i++ {
+				fmt.Fprint(w, "<activities:group>")
+				fmt.Fprintf(w, testSummaryXML, i, "2019-01-01T00:00:00.000Z", fmt.Sprintf("Work %d", i))
+				fmt.Fprint(w, "</activities:group>")
+			}
+			fmt.Fprint(w, "</activities:works>")
+		case "/v2.1/0000-0002-0183-1282/work/1":
+			fmt.Fprintf(w, testWorkXML, 1, "2019-01-01T00:00:00.000Z", "Work 1")
+		case "/v2.1/0000-0002-0183-1282/work/2":
+			// overloaded twice
+			if n <= 2 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			fmt.Fprintf(w, testWorkXML, 2, "2019-01-01T00:00:00.000Z", "Work 2")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := New(srv.URL+"/v2.1", WithRateLimit(1000), WithRetries(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	works, err := FetchWorks(context.Background(), client, id, logger)
+	perr, ok := err.(*PartialError)
+	if !ok {
+		t.Fatalf("want *PartialError, got %v", err)
+	}
+	if len(works) != 2 {
+		t.Errorf("want 2 works, got %v", len(works))
+	}
+	if _, failed := perr.Failed["/0000-0002-0183-1282/work/3"]; len(perr.Failed) != 1 || !failed || perr.Total != 3 {
+		t.Errorf("unexpected partial error: %v", perr)
+	}
+	if n := requests["/v2.1/0000-0002-0183-1282/work/2"]; n != 3 {
+		t.Errorf("want 3 requests of the overloaded work, got %v", n)
+	}
+	if n := requests["/v2.1/0000-0002-0183-1282/work/3"]; n != 1 {
+		t.Errorf("missing work must not be retried, got %v requests", n)
+	}
+}
+
+// roundTripFunc lets a function serve as a transport.
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	const id = ID("0000-0002-0183-1282")
+	var logger = log.New(ioutil.Discard, "", log.LstdFlags)
+
+	var mu sync.Mutex
+	paths := []string{}
+	hc := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+
+		body := `<activities:works xmlns:activities="http://www.orcid.org/ns/activities"></activities:works>`
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Status:     "200 OK",
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})}
+
+	client, err := New("https://pub.orcid.org/v2.1", WithHTTPClient(hc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	works, err := FetchWorks(context.Background(), client, id, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(works) != 0 {
+		t.Errorf("want no works, got %v", len(works))
+	}
+	if !reflect.DeepEqual(paths, []string{"/v2.1/0000-0002-0183-1282/works"}) {
+		t.Errorf("requests must go through the custom client, got %v", paths)
+	}
+}
+
+func TestFetchWorks_canceled(t *testing.T) {
+	const id = ID("0000-0002-0183-1282")
+	var logger = log.New(ioutil.Discard, "", log.LstdFlags)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server is stuck
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	client, err := New(srv.URL + "/v2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err = FetchWorks(ctx, client, id, logger); err == nil {
+		t.Error("want an error of the done context")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("FetchWorks must stop with the context, took %v", d)
+	}
+}
+
+func TestContributor_Names(t *testing.T) {
+	tests := []struct {
+		name       string
+		c          Contributor
+		wantGiven  string
+		wantFamily string
+	}{
+		{name: "A", c: Contributor{Name: "Jane Doe"}, wantGiven: "Jane", wantFamily: "Doe"},
+		{name: "B", c: Contributor{Name: "Doe, Jane Mary"}, wantGiven: "Jane Mary", wantFamily: "Doe"},
+		{name: "C", c: Contributor{Name: "Jane Mary Doe"}, wantGiven: "Jane Mary", wantFamily: "Doe"},
+		{name: "D", c: Contributor{Name: "Consortium"}, wantGiven: "", wantFamily: "Consortium"},
+		{name: "E", c: Contributor{Name: "J. van Doe", GivenName: "Jane", FamilyName: "van Doe"}, wantGiven: "Jane", wantFamily: "van Doe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			given, family := tt.c.Names()
+			if given != tt.wantGiven || family != tt.wantFamily {
+				t.Errorf("Names() = %q, %q, want %q, %q", given, family, tt.wantGiven, tt.wantFamily)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package orcid
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"path"
+	"time"
+)
+
+// Version is an ORCID API version.
+type Version string
+
+// Supported API versions.
+const (
+	V21 Version = "v2.1"
+	V30 Version = "v3.0"
+)
+
+// Format is a media type of API responses.
+type Format string
+
+// Supported media types.
+const (
+	XML  Format = "application/vnd.orcid+xml"
+	JSON Format = "application/vnd.orcid+json"
+)
+
+// decoder decodes API responses of a particular version and format, so
+// every combination produces the same Work.
+type decoder interface {
+	// decodeSummaries decodes the <activities:works> element.
+	decodeSummaries(r io.Reader) (*[]Work, error)
+	// decodeWork decodes the <work:work> element.
+	decodeWork(r io.Reader) (*Work, error)
+}
+
+func (c *Client) decoder() (decoder, error) {
+	if c.version != V21 && c.version != V30 {
+		return nil, fmt.Errorf("unsupported ORCID API version: %s", c.version)
+	}
+
+	switch c.format {
+	case XML:
+		if c.version == V30 {
+			return v30Decoder{}, nil
+		}
+		return v21Decoder{}, nil
+	case JSON:
+		return jsonDecoder{version: c.version}, nil
+	default:
+		return nil, fmt.Errorf("unsupported ORCID API format: %s", c.format)
+	}
+}
+
+// v21Decoder decodes API v2.1 responses, Work mirrors the schema of
+// this version.
+type v21Decoder struct{}
+
+func (v21Decoder) decodeSummaries(r io.Reader) (*[]Work, error) {
+	return decodeWorks(r)
+}
+
+func (v21Decoder) decodeWork(r io.Reader) (*Work, error) {
+	work := Work{}
+	if err := xml.NewDecoder(r).Decode(&work); err != nil {
+		return nil, err
+	}
+	return &work, nil
+}
+
+// v21Works is the <activities:works> element of API v2.1. Each group
+// holds summaries of the same work from different sources.
+type v21Works struct {
+	XMLName xml.Name `xml:"works"`
+	Groups  []struct {
+		Summaries []v21Summary `xml:"work-summary"`
+	} `xml:"group"`
+}
+
+// v21Summary is the <work:work-summary> element of API v2.1.
+type v21Summary struct {
+	Work
+	DisplayIndex int `xml:"display-index,attr"`
+}
+
+// v30Works is the <activities:works> element of API v3.0. Each group
+// holds summaries of the same work from different sources.
+type v30Works struct {
+	XMLName xml.Name `xml:"http://www.orcid.org/ns/activities works"`
+	Groups  []struct {
+		Summaries []v30Work `xml:"http://www.orcid.org/ns/work work-summary"`
+	} `xml:"http://www.orcid.org/ns/activities group"`
+}
+
+// v30Work is the <work:work> and <work:work-summary> elements of API
+// v3.0. A namespace of a field applies to every element of its path, so
+// paths through elements from different namespaces are nested structs.
+type v30Work struct {
+	Path         string    `xml:"path,attr"`
+	DisplayIndex int       `xml:"display-index,attr"`
+	Created      time.Time `xml:"http://www.orcid.org/ns/common created-date"`
+	Modified     time.Time `xml:"http://www.orcid.org/ns/common last-modified-date"`
+	SourceName   string    `xml:"http://www.orcid.org/ns/common source>source-name"`
+	Year         int       `xml:"http://www.orcid.org/ns/common publication-date>year"`
+	Month        int       `xml:"http://www.orcid.org/ns/common publication-date>month"`
+	Day          int       `xml:"http://www.orcid.org/ns/common publication-date>day"`
+	Title        struct {
+		Title string `xml:"http://www.orcid.org/ns/common title"`
+	} `xml:"http://www.orcid.org/ns/work title"`
+	JournalTitle string           `xml:"http://www.orcid.org/ns/work journal-title"`
+	CitationType string           `xml:"http://www.orcid.org/ns/work citation>citation-type"`
+	Citation     string           `xml:"http://www.orcid.org/ns/work citation>citation-value"`
+	Type         string           `xml:"http://www.orcid.org/ns/work type"`
+	ExternalIDs  []v30ExternalID  `xml:"http://www.orcid.org/ns/common external-ids>external-id"`
+	URL          string           `xml:"http://www.orcid.org/ns/common url"`
+	Contributors []v30Contributor `xml:"http://www.orcid.org/ns/work contributors>contributor"`
+}
+
+type v30ExternalID struct {
+	Type  string `xml:"http://www.orcid.org/ns/common external-id-type"`
+	Value string `xml:"http://www.orcid.org/ns/common external-id-value"`
+	URL   string `xml:"http://www.orcid.org/ns/common external-id-url"`
+}
+
+type v30Contributor struct {
+	Name     string `xml:"http://www.orcid.org/ns/work credit-name"`
+	ORCID    string `xml:"http://www.orcid.org/ns/common contributor-orcid>path"`
+	Sequence string `xml:"http://www.orcid.org/ns/work contributor-attributes>contributor-sequence"`
+	Role     string `xml:"http://www.orcid.org/ns/work contributor-attributes>contributor-role"`
+}
+
+// v30Decoder decodes API v3.0 responses.
+type v30Decoder struct{}
+
+func (v30Decoder) decodeSummaries(r io.Reader) (*[]Work, error) {
+	data := v30Works{}
+	if err := xml.NewDecoder(r).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	// only the preferred summary of a group is taken, which is the one
+	// with the highest display index, other summaries are the same work
+	// from other sources
+	works := []Work{}
+	for _, g := range data.Groups {
+		if len(g.Summaries) == 0 {
+			continue
+		}
+		preferred := g.Summaries[0]
+		for _, s := range g.Summaries[1:] {
+			if s.DisplayIndex > preferred.DisplayIndex {
+				preferred = s
+			}
+		}
+		works = append(works, *preferred.work())
+	}
+
+	return &works, nil
+}
+
+func (v30Decoder) decodeWork(r io.Reader) (*Work, error) {
+	data := v30Work{}
+	if err := xml.NewDecoder(r).Decode(&data); err != nil {
+		return nil, err
+	}
+	return data.work(), nil
+}
+
+func (v v30Work) work() *Work {
+	w := Work{
+		Created:      v.Created,
+		Modified:     v.Modified,
+		SourceName:   v.SourceName,
+		Year:         v.Year,
+		Month:        v.Month,
+		Day:          v.Day,
+		Path:         v.Path,
+		Title:        template.HTML(v.Title.Title),
+		JournalTitle: v.JournalTitle,
+		Type:         v.Type,
+		URI:          v.URL,
+	}
+
+	if len(v.CitationType) > 0 || len(v.Citation) > 0 {
+		w.Citation = &Citation{Type: v.CitationType, Value: v.Citation}
+	}
+
+	for _, id := range v.ExternalIDs {
+		w.ExternalIDs = append(w.ExternalIDs, ExternalID{
+			Type:  id.Type,
+			Value: id.Value,
+			URL:   template.HTML(id.URL),
+		})
+	}
+
+	for _, c := range v.Contributors {
+		w.Contributors = append(w.Contributors, &Contributor{
+			Name:     c.Name,
+			ORCID:    ID(c.ORCID),
+			Sequence: c.Sequence,
+			Role:     contributorRole(c.Role),
+		})
+	}
+
+	return &w
+}
+
+// contributorRole turns CRediT role URIs which are used along with the
+// old role names since v3.0 into short names, e.g.
+// https://credit.niso.org/contributor-roles/writing-original-draft/
+// becomes writing-original-draft.
+func contributorRole(role string) string {
+	if len(role) == 0 {
+		return role
+	}
+	return path.Base(role)
+}
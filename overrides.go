@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"regexp"
+
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
+	"bitbucket.org/iharsuvorau/ims-publications/orcid"
+)
+
+// overrides are manual corrections of works of users keyed by ORCID
+// iDs. They fix what can't be fixed in ORCID records of other people:
+// hide works, override fields of works and pin works missing in ORCID.
+// Hidden and pinned works are applied after works are read from ORCID or
+// the cache and their missing DOIs are recovered, fields are overridden
+// after works are completed. The cache keeps works as they are in ORCID.
+type overrides map[orcid.ID]*userOverrides
+
+// userOverrides are corrections of works of a user.
+type userOverrides struct {
+	// Hide lists works which are not shown.
+	Hide []workMatch `yaml:"hide" json:"hide"`
+	// Override sets fields of works, empty fields are kept as they
+	// are in ORCID.
+	Override []workOverride `yaml:"override" json:"override"`
+	// Pin lists manual works added to the works from ORCID.
+	Pin []pinnedWork `yaml:"pin" json:"pin"`
+}
+
+// workMatch selects a work by its DOI or put-code.
+type workMatch struct {
+	DOI     string `yaml:"doi" json:"doi"`
+	PutCode string `yaml:"put-code" json:"put-code"`
+}
+
+// workFields are fields of a work set manually.
+type workFields struct {
+	Title        string   `yaml:"title" json:"title"`
+	Type         string   `yaml:"type" json:"type"`
+	Year         int      `yaml:"year" json:"year"`
+	JournalTitle string   `yaml:"journal-title" json:"journal-title"`
+	Contributors []string `yaml:"contributors" json:"contributors"`
+}
+
+type workOverride struct {
+	workMatch  `yaml:",inline"`
+	workFields `yaml:",inline"`
+}
+
+type pinnedWork struct {
+	workFields `yaml:",inline"`
+	DOI        string `yaml:"doi" json:"doi"`
+	URL        string `yaml:"url" json:"url"`
+}
+
+// readOverrides reads overrides from the file, JSON is expected for
+// files with the .json extension and YAML for others. Overrides are
+// validated, so mistakes are reported before anything is fetched.
+func readOverrides(path string) (overrides, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	o := overrides{}
+	if err = decodeConfig(path, data, &o); err != nil {
+		return nil, fmt.Errorf("failed to decode overrides %s: %v", path, err)
+	}
+
+	if err = o.validate(); err != nil {
+		return nil, fmt.Errorf("invalid overrides %s: %v", path, err)
+	}
+	return o, nil
+}
+
+// orcidIDSyntax is four groups of four digits, the last one might be X.
+var orcidIDSyntax = regexp.MustCompile(`^[0-9]{4}-[0-9]{4}-[0-9]{4}-[0-9]{3}[0-9X]$`)
+
+func (o overrides) validate() error {
+	for id, uo := range o {
+		if !orcidIDSyntax.MatchString(string(id)) {
+			return fmt.Errorf("bad ORCID iD %q", id)
+		}
+		if uo == nil {
+			continue
+		}
+		for i, m := range uo.Hide {
+			if err := m.validate(); err != nil {
+				return fmt.Errorf("%v: hide #%d: %v", id, i+1, err)
+			}
+		}
+		for i, ov := range uo.Override {
+			if err := ov.workMatch.validate(); err != nil {
+				return fmt.Errorf("%v: override #%d: %v", id, i+1, err)
+			}
+		}
+		for i, p := range uo.Pin {
+			if len(p.Title) == 0 {
+				return fmt.Errorf("%v: pin #%d: the title is required", id, i+1)
+			}
+			if len(p.DOI) > 0 {
+				if _, err := doi.Parse(p.DOI); err != nil {
+					return fmt.Errorf("%v: pin #%d: %v", id, i+1, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (m workMatch) validate() error {
+	if len(m.DOI) == 0 && len(m.PutCode) == 0 {
+		return fmt.Errorf("a DOI or put-code is required")
+	}
+	if len(m.DOI) > 0 {
+		if _, err := doi.Parse(m.DOI); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matches checks if the work is the one selected by the DOI or
+// put-code.
+func (m workMatch) matches(w *orcid.Work) bool {
+	if len(m.PutCode) > 0 && m.PutCode == w.PutCode() {
+		return true
+	}
+	if len(m.DOI) == 0 {
+		return false
+	}
+	want, err := doi.Parse(m.DOI)
+	if err != nil {
+		return false
+	}
+	id, err := w.DOI()
+	return err == nil && id == want
+}
+
+func (m workMatch) String() string {
+	if len(m.DOI) > 0 {
+		return m.DOI
+	}
+	return "put-code " + m.PutCode
+}
+
+// contributors returns contributors of the names.
+func (f workFields) contributors() []*orcid.Contributor {
+	contribs := make([]*orcid.Contributor, len(f.Contributors))
+	for i, name := range f.Contributors {
+		contribs[i] = &orcid.Contributor{Name: name, Role: "author"}
+	}
+	return contribs
+}
+
+// set overrides fields of the work with non-empty fields.
+func (f workFields) set(w *orcid.Work) {
+	if len(f.Title) > 0 {
+		w.Title = template.HTML(f.Title)
+	}
+	if len(f.Type) > 0 {
+		w.Type = f.Type
+	}
+	if f.Year > 0 && f.Year != w.Year {
+		// the month and day of a wrong year are likely wrong too
+		w.Year, w.Month, w.Day = f.Year, 0, 0
+	}
+	if len(f.JournalTitle) > 0 {
+		w.JournalTitle = f.JournalTitle
+	}
+	if len(f.Contributors) > 0 {
+		w.Contributors = f.contributors()
+	}
+}
+
+// modifier returns a modifier which overrides fields of works of the
+// user. It runs after works are completed from CrossRef and DataCite, so
+// their types don't replace overridden ones, e.g. other.
+func (o overrides) modifier(id orcid.ID) orcid.WorksModifier {
+	return func(works []*orcid.Work) {
+		uo := o[id]
+		if uo == nil {
+			return
+		}
+		for _, w := range works {
+			for _, ov := range uo.Override {
+				if ov.matches(w) {
+					ov.set(w)
+				}
+			}
+		}
+	}
+}
+
+// apply removes hidden works of the user and adds pinned ones, fields
+// are overridden later by the modifier. Overrides which match no work
+// are reported.
+func (o overrides) apply(u *user, logger *log.Logger) {
+	uo := o[u.OrcID]
+	if uo == nil {
+		return
+	}
+
+	for _, ov := range uo.Override {
+		if !matchesAny(ov.workMatch, u.Works) {
+			logger.Printf("override of %v doesn't match any work of %v", ov.workMatch, u.Title)
+		}
+	}
+
+	works := make([]*orcid.Work, 0, len(u.Works)+len(uo.Pin))
+	hidden := map[int]bool{}
+	for _, w := range u.Works {
+		hide := false
+		for i, m := range uo.Hide {
+			if m.matches(w) {
+				hide, hidden[i] = true, true
+			}
+		}
+		if hide {
+			logger.Printf("work %q of %v is hidden by overrides", w.Title, u.Title)
+			continue
+		}
+		works = append(works, w)
+	}
+	for i, m := range uo.Hide {
+		if !hidden[i] {
+			logger.Printf("hidden %v doesn't match any work of %v", m, u.Title)
+		}
+	}
+
+	for _, p := range uo.Pin {
+		works = append(works, p.work())
+	}
+
+	u.Works = works
+}
+
+func matchesAny(m workMatch, works []*orcid.Work) bool {
+	for _, w := range works {
+		if m.matches(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// work returns the pinned work as an ORCID one.
+func (p pinnedWork) work() *orcid.Work {
+	w := &orcid.Work{URI: p.URL}
+	p.set(w)
+	if id, err := doi.Parse(p.DOI); err == nil {
+		w.ExternalIDs = []orcid.ExternalID{{Type: "doi", Value: id.String(), URL: template.HTML(id.URL())}}
+		w.DoiURI = template.HTML(id.URL())
+	}
+	return w
+}
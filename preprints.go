@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+
+	"bitbucket.org/iharsuvorau/ims-publications/cache"
+	"bitbucket.org/iharsuvorau/ims-publications/crossref"
+	"bitbucket.org/iharsuvorau/ims-publications/doi"
+	"bitbucket.org/iharsuvorau/ims-publications/orcid"
+)
+
+// preprintDOIPrefixes are DOI prefixes of preprint servers.
+var preprintDOIPrefixes = []string{
+	"10.48550/arxiv.",    // arXiv
+	"10.1101/",           // bioRxiv and medRxiv
+	"10.20944/preprints", // Preprints.org
+	"10.21203/rs.",       // Research Square
+	"10.31219/osf.io",    // OSF Preprints
+	"10.36227/techrxiv",  // TechRxiv
+	"10.26434/chemrxiv",  // ChemRxiv
+	"10.2139/ssrn.",      // SSRN
+}
+
+// arXivDOIPrefix is the prefix of DOIs registered by arXiv, the rest of
+// such a DOI is the arXiv identifier.
+const arXivDOIPrefix = "10.48550/arxiv."
+
+// preprintYears is how many years a preprint might be posted before its
+// published version.
+const preprintYears = 3
+
+// isPreprint checks if the work is a preprint: its type is preprint, or
+// the type is unknown and the work is only registered with a preprint
+// server.
+func isPreprint(w *orcid.Work) bool {
+	if w.Type == "preprint" {
+		return true
+	}
+	if len(w.Type) > 0 && w.Type != "other" {
+		return false
+	}
+
+	id, err := w.DOI()
+	if err != nil {
+		return len(w.ArXivID()) > 0
+	}
+	for _, prefix := range preprintDOIPrefixes {
+		if strings.HasPrefix(string(id), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// workKeys returns normalized identifiers of the work, see
+// externalIDKey. arXiv DOIs are keyed by the arXiv identifier too.
+func workKeys(w *orcid.Work) map[string]bool {
+	keys := map[string]bool{}
+	for _, id := range w.ExternalIDs {
+		if k := externalIDKey(id); len(k) > 0 {
+			keys[k] = true
+		}
+	}
+	if id, err := w.DOI(); err == nil {
+		for _, k := range doiKeys(id) {
+			keys[k] = true
+		}
+	}
+	return keys
+}
+
+// doiKeys returns keys of the DOI, an arXiv DOI is an arXiv identifier
+// too.
+func doiKeys(id doi.DOI) []string {
+	keys := []string{"doi:" + id.String()}
+	if strings.HasPrefix(string(id), arXivDOIPrefix) {
+		keys = append(keys, externalIDKey(orcid.ExternalID{Type: "arxiv", Value: string(id)[len(arXivDOIPrefix):]}))
+	}
+	return keys
+}
+
+// relationKeys returns keys of the related object, see workKeys.
+func relationKeys(r crossref.Relation) []string {
+	switch strings.ToLower(r.IDType) {
+	case "doi":
+		if id, err := doi.Parse(r.ID); err == nil {
+			return doiKeys(id)
+		}
+	case "arxiv":
+		if k := externalIDKey(orcid.ExternalID{Type: "arxiv", Value: r.ID}); len(k) > 0 {
+			return []string{k}
+		}
+	}
+	return nil
+}
+
+// linkPreprints finds published versions of preprints among works of
+// each user and moves the preprints to Preprints of the published
+// works, so they are shown together.
+func linkPreprints(ctx context.Context, cref *crossref.Client, c *cache.Cache, users []*user, logger *log.Logger) error {
+	for _, u := range users {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("preprint linking is interrupted: %v", err)
+		}
+		u.Works = linkWorkPreprints(ctx, cref, c, u.Works, logger)
+	}
+	return nil
+}
+
+// linkWorkPreprints links preprints to their published versions and
+// returns the works without the linked preprints. A published version
+// is found by a shared identifier, CrossRef relations
+// is-preprint-of/has-preprint and at last by a similar title. CrossRef
+// is only requested for works of users with preprints, a nil client
+// disables relations.
+func linkWorkPreprints(ctx context.Context, cref *crossref.Client, c *cache.Cache, works []*orcid.Work, logger *log.Logger) []*orcid.Work {
+	published := []*orcid.Work{}
+	preprints := []*orcid.Work{}
+	for _, w := range works {
+		if isPreprint(w) {
+			preprints = append(preprints, w)
+		} else {
+			published = append(published, w)
+		}
+	}
+	if len(preprints) == 0 || len(published) == 0 {
+		return works
+	}
+
+	byKey := map[string]*orcid.Work{}
+	for _, w := range published {
+		for k := range workKeys(w) {
+			if _, ok := byKey[k]; !ok {
+				byKey[k] = w
+			}
+		}
+	}
+
+	// CrossRef works of all DOIs are requested in batches, so scanning
+	// relations of published works doesn't request them one by one
+	var prefetched map[doi.DOI]*crossref.Work
+	if cref != nil {
+		ids := []doi.DOI{}
+		for _, w := range works {
+			if id, err := w.DOI(); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		prefetched = prefetchCrossRefDOIs(ctx, cref, c, ids, logger)
+	}
+
+	// CrossRef works are looked up once and only when needed
+	crossRefWorks := map[*orcid.Work]*crossref.Work{}
+	relations := func(w *orcid.Work, t string) []crossref.Relation {
+		if cref == nil || ctx.Err() != nil {
+			return nil
+		}
+		id, err := w.DOI()
+		if err != nil {
+			return nil
+		}
+		cw, ok := crossRefWorks[w]
+		if !ok {
+			if cw, err = lookupCrossRefWork(ctx, cref, c, prefetched, id, logger); err != nil {
+				logger.Printf("crossref fetch error: %v", err)
+			}
+			crossRefWorks[w] = cw
+		}
+		if cw == nil {
+			return nil
+		}
+		return cw.Relations[t]
+	}
+
+	publishedVersion := func(p *orcid.Work) (*orcid.Work, string) {
+		keys := workKeys(p)
+		for k := range keys {
+			if w, ok := byKey[k]; ok {
+				return w, "shared " + k
+			}
+		}
+
+		for _, r := range relations(p, crossref.IsPreprintOf) {
+			for _, k := range relationKeys(r) {
+				if w, ok := byKey[k]; ok {
+					return w, crossref.IsPreprintOf + " " + k
+				}
+			}
+		}
+
+		for _, w := range published {
+			for _, r := range relations(w, crossref.HasPreprint) {
+				for _, k := range relationKeys(r) {
+					if keys[k] {
+						return w, crossref.HasPreprint + " " + k
+					}
+				}
+			}
+		}
+
+		var best *orcid.Work
+		var bestSim float64
+		for _, w := range published {
+			if p.Year > 0 && w.Year > 0 && (w.Year-p.Year > preprintYears || p.Year-w.Year > dedupYearDistance) {
+				continue
+			}
+			if sim := titleSimilarity(string(p.Title), string(w.Title)); sim >= dedupTitleThreshold && sim > bestSim {
+				best, bestSim = w, sim
+			}
+		}
+		if best != nil {
+			return best, fmt.Sprintf("title similarity %.2f", bestSim)
+		}
+		return nil, ""
+	}
+
+	linked := map[*orcid.Work]bool{}
+	for _, p := range preprints {
+		w, reason := publishedVersion(p)
+		if w == nil {
+			continue
+		}
+		logger.Printf("preprint %q is linked to %q (%s)", p.Title, w.Title, reason)
+		w.Preprints = append(w.Preprints, p)
+		linked[p] = true
+	}
+
+	rest := make([]*orcid.Work, 0, len(works)-len(linked))
+	for _, w := range works {
+		if !linked[w] {
+			rest = append(rest, w)
+		}
+	}
+	return rest
+}
+
+// preprintLink formats a MediaWiki link to the preprint, e.g.
+// [https://arxiv.org/abs/1801.00001 arXiv:1801.00001].
+func preprintLink(w *orcid.Work) template.HTML {
+	id := w.ArXivID()
+	if len(id) == 0 {
+		if v, err := w.DOI(); err == nil && strings.HasPrefix(string(v), arXivDOIPrefix) {
+			id = string(v)[len(arXivDOIPrefix):]
+		}
+	}
+	if len(id) > 0 {
+		id = template.HTMLEscapeString(id)
+		return template.HTML(fmt.Sprintf("[https://arxiv.org/abs/%s arXiv:%s]", id, id))
+	}
+
+	if v, err := w.DOI(); err == nil {
+		return template.HTML(fmt.Sprintf("[%s doi:%s]", template.HTMLEscapeString(v.URL()), template.HTMLEscapeString(v.String())))
+	}
+	if len(w.URI) > 0 {
+		return template.HTML(fmt.Sprintf("[%s <nowiki>%s</nowiki>]", template.HTMLEscapeString(w.URI), w.Title))
+	}
+	return template.HTML(fmt.Sprintf("<nowiki>%s</nowiki>", w.Title))
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bitbucket.org/iharsuvorau/mediawiki"
+)
+
+// publisher delivers rendered markup to its destination.
+type publisher interface {
+	// UpdateSection replaces the level 2 section of the page with the
+	// markup or adds a new section if there is no such one.
+	UpdateSection(pageTitle, sectionTitle, markup string) error
+	// Purge cleans the cache for the pages.
+	Purge(pageTitles ...string) error
+}
+
+// wikiPublisher writes pages to MediaWiki.
+type wikiPublisher struct {
+	mwURI  string
+	lgName string
+	lgPass string
+}
+
+func (p *wikiPublisher) UpdateSection(pageTitle, sectionTitle, markup string) error {
+	const contentModel = "wikitext"
+	_, err := mediawiki.UpdatePage(p.mwURI, pageTitle, markup, contentModel, p.lgName, p.lgPass, sectionTitle)
+	return err
+}
+
+func (p *wikiPublisher) Purge(pageTitles ...string) error {
+	return mediawiki.Purge(p.mwURI, pageTitles...)
+}
+
+// dryRunPublisher never logs in or edits anything, it saves the markup
+// into a local directory together with a diff against the current
+// content of the section on MediaWiki.
+type dryRunPublisher struct {
+	mwURI  string
+	outDir string
+	logger *log.Logger
+}
+
+func newDryRunPublisher(mwURI, outDir string, logger *log.Logger) (*dryRunPublisher, error) {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the output directory %s: %v", outDir, err)
+	}
+	return &dryRunPublisher{mwURI: mwURI, outDir: outDir, logger: logger}, nil
+}
+
+func (p *dryRunPublisher) UpdateSection(pageTitle, sectionTitle, markup string) error {
+	current, err := getSectionMarkup(p.mwURI, pageTitle, sectionTitle)
+	if err != nil {
+		return fmt.Errorf("failed to get the current content of %s: %v", pageTitle, err)
+	}
+
+	// the section header is added by mediawiki.UpdatePage, so it's
+	// added here too to compare the whole sections
+	markup = fmt.Sprintf("== %s ==\n\n%s", sectionTitle, markup)
+
+	fname := pageFileName(pageTitle)
+	fpath := filepath.Join(p.outDir, fname+".wiki")
+	if err = ioutil.WriteFile(fpath, []byte(markup), 0644); err != nil {
+		return err
+	}
+
+	diff := unifiedDiff(pageTitle+" (current)", pageTitle+" (rendered)", current, markup)
+	dpath := filepath.Join(p.outDir, fname+".diff")
+	if err = ioutil.WriteFile(dpath, []byte(diff), 0644); err != nil {
+		return err
+	}
+
+	if len(diff) == 0 {
+		p.logger.Printf("dry run: %s is unchanged, markup is saved to %s", pageTitle, fpath)
+	} else {
+		p.logger.Printf("dry run: %s would change, markup is saved to %s, diff to %s", pageTitle, fpath, dpath)
+	}
+	return nil
+}
+
+func (p *dryRunPublisher) Purge(pageTitles ...string) error {
+	p.logger.Printf("dry run: skipping purge of %v", pageTitles)
+	return nil
+}
+
+// getSectionMarkup returns the wikitext of the last level 2 section with
+// the title including its header, which is the one updated by
+// mediawiki.UpdatePage. If there is no such section, an empty string is
+// returned.
+func getSectionMarkup(mwURI, pageTitle, sectionTitle string) (string, error) {
+	params := url.Values{}
+	params.Set("action", "parse")
+	params.Set("format", "json")
+	params.Set("page", pageTitle)
+	params.Set("prop", "sections")
+
+	data, err := mediawiki.Get(mwURI, params.Encode())
+	if err != nil {
+		return "", err
+	}
+
+	// a missing page has no sections
+	if _, ok := data["error"]; ok {
+		return "", nil
+	}
+
+	parse, ok := data["parse"].(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("getSectionMarkup: unexpected parse type: %+v", data)
+	}
+	sections, ok := parse["sections"].([]interface{})
+	if !ok {
+		return "", fmt.Errorf("getSectionMarkup: unexpected sections type: %+v", parse)
+	}
+
+	var index string
+	for _, v := range sections {
+		section, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// mediawiki.UpdatePage edits the last section with the title,
+		// so the diff shows the same one
+		if section["level"] == "2" && section["line"] == sectionTitle {
+			index, _ = section["index"].(string)
+		}
+	}
+	if len(index) == 0 {
+		return "", nil
+	}
+
+	params.Set("prop", "wikitext")
+	params.Set("section", index)
+
+	data, err = mediawiki.Get(mwURI, params.Encode())
+	if err != nil {
+		return "", err
+	}
+
+	parse, ok = data["parse"].(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("getSectionMarkup: unexpected parse type: %+v", data)
+	}
+	wikitext, ok := parse["wikitext"].(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("getSectionMarkup: unexpected wikitext type: %+v", parse)
+	}
+	markup, ok := wikitext["*"].(string)
+	if !ok {
+		return "", fmt.Errorf("getSectionMarkup: unexpected wikitext content type: %+v", wikitext)
+	}
+
+	return markup, nil
+}
+
+// pageFileName makes a file name out of a page title.
+func pageFileName(pageTitle string) string {
+	return strings.NewReplacer("/", "_", ":", "_", " ", "_").Replace(pageTitle)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"bitbucket.org/iharsuvorau/ims-publications/orcid"
+	"gopkg.in/yaml.v2"
+)
+
+// section is a section of a publications page listing works of some
+// ORCID types, e.g. journal-article or book-chapter.
+type section struct {
+	Title string `yaml:"title" json:"title"`
+	// Types are ORCID work types of the section. A section without
+	// types gets works of all types which are not listed in other
+	// sections.
+	Types []string `yaml:"types" json:"types"`
+	// Hidden sections are not shown, so works of their types are not
+	// listed at all.
+	Hidden bool `yaml:"hidden" json:"hidden"`
+}
+
+// taxonomy is an ordered list of sections of publications pages.
+type taxonomy []section
+
+// defaultTaxonomy lists journal articles and conference papers, works
+// of other types are listed in the last section.
+var defaultTaxonomy = taxonomy{
+	{Title: "Journal Articles", Types: []string{"journal-article"}},
+	{Title: "Conference Papers", Types: []string{"conference-paper"}},
+	{Title: "Other"},
+}
+
+// readTaxonomy reads sections from the file, JSON is expected for files
+// with the .json extension and YAML for others.
+func readTaxonomy(path string) (taxonomy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := taxonomy{}
+	if err = decodeConfig(path, data, &t); err != nil {
+		return nil, fmt.Errorf("failed to decode sections %s: %v", path, err)
+	}
+
+	if err = t.validate(); err != nil {
+		return nil, fmt.Errorf("invalid sections %s: %v", path, err)
+	}
+	return t, nil
+}
+
+// decodeConfig decodes data of the configuration file, JSON is expected
+// for files with the .json extension and YAML for others. Unknown keys
+// are an error in both formats, so misspelled ones aren't ignored.
+func decodeConfig(path string, data []byte, v interface{}) error {
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		return yaml.UnmarshalStrict(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// validate checks that shown sections have titles and each type feeds
+// a single section.
+func (t taxonomy) validate() error {
+	if len(t) == 0 {
+		return fmt.Errorf("no sections")
+	}
+
+	types := map[string]int{}
+	rest := -1
+	for i, s := range t {
+		if len(s.Title) == 0 && !s.Hidden {
+			return fmt.Errorf("section #%d: the title is required", i+1)
+		}
+		if len(s.Types) == 0 {
+			if rest >= 0 {
+				return fmt.Errorf("sections %q and %q: only one section might have no types", t[rest].Title, s.Title)
+			}
+			rest = i
+		}
+		for _, typ := range s.Types {
+			if j, ok := types[typ]; ok {
+				return fmt.Errorf("sections %q and %q: the type %s is listed twice", t[j].Title, s.Title, typ)
+			}
+			types[typ] = i
+		}
+	}
+	return nil
+}
+
+// sectionOf returns the index of the section of the work type or -1 if
+// works of the type are not shown.
+func (t taxonomy) sectionOf(workType string) int {
+	rest := -1
+	for i, s := range t {
+		if len(s.Types) == 0 && rest < 0 {
+			rest = i
+		}
+		for _, typ := range s.Types {
+			if typ == workType {
+				if s.Hidden {
+					return -1
+				}
+				return i
+			}
+		}
+	}
+	if rest >= 0 && t[rest].Hidden {
+		return -1
+	}
+	return rest
+}
+
+// shown returns works of types which are shown.
+func (t taxonomy) shown(works []*orcid.Work) []*orcid.Work {
+	shown := []*orcid.Work{}
+	for _, w := range works {
+		if t.sectionOf(w.Type) >= 0 {
+			shown = append(shown, w)
+		}
+	}
+	return shown
+}
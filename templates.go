@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+
+	"bitbucket.org/iharsuvorau/ims-publications/orcid"
+)
+
+// defaultTemplates are the templates of the default jobs built into the
+// binary, so it doesn't depend on the working directory.
+//
+//go:embed publications-list.tmpl publications-by-year.tmpl
+var defaultTemplates embed.FS
+
+// isDefaultTemplate checks if the name refers to a built-in template.
+func isDefaultTemplate(name string) bool {
+	if filepath.Base(name) != name {
+		return false
+	}
+	_, err := defaultTemplates.Open(name)
+	return err == nil
+}
+
+// parseTemplate parses the template file. Names of the default templates
+// without a directory refer to the built-in ones, other names are paths.
+func parseTemplate(path string) (*template.Template, error) {
+	tmpl := template.New(filepath.Base(path)).Funcs(tmplFuncs)
+	var err error
+	if isDefaultTemplate(path) {
+		tmpl, err = tmpl.ParseFS(defaultTemplates, path)
+	} else {
+		tmpl, err = tmpl.ParseFiles(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the template %s: %v", path, err)
+	}
+	return tmpl, nil
+}
+
+func renderTmpl(data interface{}, tmplPath string) (string, error) {
+	tmpl, err := parseTemplate(tmplPath)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, data)
+	return out.String(), err
+}
+
+// sampleWorks have all fields used by templates, preprints and several
+// members to execute every branch of a template.
+func sampleWorks() []*orcid.Work {
+	preprint := &orcid.Work{
+		Title:       "A Sample Preprint",
+		Year:        2018,
+		Type:        "preprint",
+		ExternalIDs: []orcid.ExternalID{{Type: "arxiv", Value: "1801.00001"}},
+	}
+	return []*orcid.Work{
+		{
+			Title:        "A Sample Article",
+			Year:         2019,
+			Month:        5,
+			Type:         "journal-article",
+			JournalTitle: "Sample Journal",
+			Contributors: []*orcid.Contributor{{Name: "Jane Doe", Role: "author"}, {Name: "John Roe", Role: "author"}},
+			ExternalIDs:  []orcid.ExternalID{{Type: "doi", Value: "10.1000/sample", URL: "https://doi.org/10.1000/sample"}},
+			DoiURI:       "https://doi.org/10.1000/sample",
+			Preprints:    []*orcid.Work{preprint},
+			Members:      []string{"Jane Doe", "John Roe"},
+		},
+		{
+			Title:   "A Sample Paper",
+			Year:    2018,
+			Type:    "conference-paper",
+			URI:     "https://example.org/paper",
+			Members: []string{"Jane Doe"},
+		},
+		{Title: "A Sample Work", Type: "other"},
+	}
+}
+
+// checkTemplate parses the template and executes it on sample works
+// grouped by the grouper, so a broken template fails before any page is
+// updated.
+func checkTemplate(path string, g grouper) error {
+	tmpl, err := parseTemplate(path)
+	if err != nil {
+		return err
+	}
+	if err = tmpl.Execute(ioutil.Discard, g.Group(sampleWorks())); err != nil {
+		return fmt.Errorf("failed to execute the template %s: %v", path, err)
+	}
+	return nil
+}